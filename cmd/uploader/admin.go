@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+)
+
+// requireAdmin wraps a handler with HTTP basic authentication using the
+// configured admin credentials. All admin handlers respond with 404 if no
+// admin password is configured.
+func (uploader *Uploader) requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := uploader.Config()
+		if cfg.AdminPW == "" {
+			http.NotFound(w, r)
+			return
+		}
+		user, pass, ok := r.BasicAuth()
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(cfg.AdminUser)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(cfg.AdminPW)) == 1
+		if !ok || !userOK || !passOK {
+			if ok {
+				log.Printf("ERROR Invalid admin credentials for user %q from %s", user, r.RemoteAddr)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="uploader admin"`)
+			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// adminConfig shows the effective configuration with secret values
+// redacted and the list of values changed from the defaults.
+func (uploader *Uploader) adminConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	data := map[string]interface{}{
+		"version": verstr,
+		"config":  cfg.fields(),
+		"changed": diffConfig(defaultConfig(), cfg),
+	}
+	writeJSON(w, http.StatusOK, data)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// uploadKeyHeader is the request header carrying the upload key for API
+// requests.
+const uploadKeyHeader = "X-Upload-Key"
+
+// apiFailure writes a JSON error response for an API request.
+func apiFailure(w http.ResponseWriter, serr *submissionError) {
+	writeJSON(w, serr.Status, apiError{Code: serr.Code, Message: string(tr(defaultLanguage, serr.Message, serr.Args...))})
+}
+
+// apiSubmit handles submissions via the JSON API. The request body is the
+// same multipart form as for the HTML form, without the passcode field.
+func (uploader *Uploader) apiSubmit(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	log.Print("API submission received")
+	user, serr := uploader.authenticate(r.Header.Get(uploadKeyHeader))
+	if serr != nil {
+		apiFailure(w, serr)
+		return
+	}
+	if serr := checkFreeSpace(cfg, r.ContentLength); serr != nil {
+		apiFailure(w, serr)
+		return
+	}
+	if err := r.ParseMultipartForm(1048576); err != nil { // 1 MiB max mem
+		log.Printf("Failed to parse form: %v", err.Error())
+		apiFailure(w, newSubmissionError(http.StatusBadRequest, "invalid_request", "error.internal"))
+		return
+	}
+	result, serr := uploader.saveSubmission(cfg, r, user)
+	if serr != nil {
+		apiFailure(w, serr)
+		return
+	}
+	if len(result.Changed) > 0 {
+		uploader.publish(user.ID)
+	}
+	uploader.transcode(result)
+	w.Header().Set("Location", "/api/v1/submissions/"+user.ID)
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// apiSubmission returns the files currently stored for a poster. The upload
+// key must belong to the requested poster.
+func (uploader *Uploader) apiSubmission(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	user, serr := uploader.authenticate(r.Header.Get(uploadKeyHeader))
+	if serr != nil {
+		apiFailure(w, serr)
+		return
+	}
+	if mux.Vars(r)["id"] != user.ID {
+		apiFailure(w, newSubmissionError(http.StatusNotFound, "not_found", "error.notfound"))
+		return
+	}
+	result, err := currentSubmission(cfg, user)
+	if err != nil {
+		log.Printf("ERROR reading submission of %q: %v", user.ID, err)
+		apiFailure(w, newSubmissionError(http.StatusInternalServerError, "storage_error", "error.internal"))
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
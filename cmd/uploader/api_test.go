@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestUploader creates an Uploader with a temporary upload directory
+// and a posters file containing a single poster with ID "id" and upload
+// key "key". The returned function removes all temporary files.
+func newTestUploader(t *testing.T) (*Uploader, func()) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_uploader")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	cfg := defaultConfig()
+	cfg.UploadDirectory = filepath.Join(tmpDir, "uploads")
+	cfg.PostersInfoFile = filepath.Join(tmpDir, "posters.json")
+	cfg.WhitelistFile = filepath.Join(tmpDir, "whitelist.txt")
+	cfg.WithdrawnDirectory = filepath.Join(tmpDir, "withdrawn")
+	cfg.ManifestFile = filepath.Join(tmpDir, "manifest.jsonl")
+	cfg.QuarantineDirectory = filepath.Join(tmpDir, "quarantine")
+	cfg.PublishWorkDirectory = filepath.Join(tmpDir, "gallery")
+	cfg.PublishQueueFile = filepath.Join(tmpDir, "publish-queue.json")
+	cfg.TranscodeQueueFile = filepath.Join(tmpDir, "transcode-queue.json")
+	// external commands are replaced by stubs where required
+	cfg.PreviewCommand = ""
+	cfg.PDFTextCommand = ""
+	cfg.VideoProbeCommand = ""
+	cfg.TranscodeCommand = ""
+	// submissions do not depend on the free space of the test machine
+	cfg.MinFreeSpace = 0
+	posters := `[{"ID": "id", "upload_key": "key", "Title": "Title", "Authors": "Author"},
+		{"ID": "other", "upload_key": "otherkey", "Title": "Other", "Authors": "Other Author", "abstract_number": "W 42"}]`
+	if err := ioutil.WriteFile(cfg.PostersInfoFile, []byte(posters), 0644); err != nil {
+		t.Fatalf("Error writing posters file: %v", err)
+	}
+	if err := os.MkdirAll(cfg.UploadDirectory, 0777); err != nil {
+		t.Fatalf("Error creating upload dir: %v", err)
+	}
+	return NewUploader(cfg), func() { os.RemoveAll(tmpDir) }
+}
+
+// newSubmissionRequest creates a multipart request with the provided form
+// fields and files (field name -> [file name, content]).
+func newSubmissionRequest(t *testing.T, target string, fields map[string]string, files map[string][2]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatalf("Error writing form field: %v", err)
+		}
+	}
+	for name, file := range files {
+		part, err := writer.CreateFormFile(name, file[0])
+		if err != nil {
+			t.Fatalf("Error creating form file: %v", err)
+		}
+		if _, err := part.Write([]byte(file[1])); err != nil {
+			t.Fatalf("Error writing file content: %v", err)
+		}
+	}
+	_ = writer.Close()
+	req := httptest.NewRequest("POST", target, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestAPISubmission(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	fields := map[string]string{"video_url": "https://example.com/video"}
+
+	// missing and invalid keys
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, newSubmissionRequest(t, "/api/v1/submissions", fields, files))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected unauthorised status, got %d", w.Code)
+	}
+	apierr := apiError{}
+	if err := json.Unmarshal(w.Body.Bytes(), &apierr); err != nil || apierr.Code != "missing_upload_key" {
+		t.Fatalf("Unexpected error response: %s", w.Body.String())
+	}
+
+	req := newSubmissionRequest(t, "/api/v1/submissions", fields, files)
+	req.Header.Set(uploadKeyHeader, "wrong")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected unauthorised status, got %d", w.Code)
+	}
+
+	// valid submission
+	req = newSubmissionRequest(t, "/api/v1/submissions", fields, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status code %d: %s", w.Code, w.Body.String())
+	}
+	result := submissionResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if result.ID != "id" || result.Poster == nil || result.Poster.SHA1 != sha1String("%PDF-1.4 test") {
+		t.Fatalf("Unexpected submission result: %s", w.Body.String())
+	}
+	if result.VideoURL != "https://example.com/video" {
+		t.Fatalf("Unexpected video URL: %q", result.VideoURL)
+	}
+
+	// submission status
+	req = httptest.NewRequest("GET", "/api/v1/submissions/id", nil)
+	req.Header.Set(uploadKeyHeader, "key")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d: %s", w.Code, w.Body.String())
+	}
+	status := submissionResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if status.Poster == nil || status.Poster.SHA1 != result.Poster.SHA1 || status.VideoURL != result.VideoURL {
+		t.Fatalf("Unexpected submission status: %s", w.Body.String())
+	}
+
+	// other posters cannot be accessed
+	req = httptest.NewRequest("GET", "/api/v1/submissions/other", nil)
+	req.Header.Set(uploadKeyHeader, "key")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected not found status, got %d", w.Code)
+	}
+}
+
+func TestSubmitContentNegotiation(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+
+	// form submission returns the HTML success page
+	req := newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") == "application/json" {
+		t.Fatalf("Expected HTML success page, got %d (%s)", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// JSON clients get JSON results and errors
+	req = newSubmissionRequest(t, "/submit", map[string]string{"passcode": "wrong"}, files)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	apierr := apiError{}
+	if err := json.Unmarshal(w.Body.Bytes(), &apierr); err != nil || apierr.Code != "invalid_upload_key" {
+		t.Fatalf("Unexpected error response: %s", w.Body.String())
+	}
+
+	req = newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	result := submissionResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.Poster == nil {
+		t.Fatalf("Unexpected JSON result: %s", w.Body.String())
+	}
+}
+
+func TestSubmissionClosed(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.SubmissionClosedDate = "2000-01-01"
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	req := newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Unexpected status code %d", w.Code)
+	}
+	apierr := apiError{}
+	if err := json.Unmarshal(w.Body.Bytes(), &apierr); err != nil || apierr.Code != "submission_closed" {
+		t.Fatalf("Unexpected error response: %s", w.Body.String())
+	}
+
+	// the form is refused as well, even if it was loaded before the deadline
+	req = newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files)
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "submission is closed") {
+		t.Fatalf("Unexpected form response %d: %s", w.Code, w.Body.String())
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPartialSubmission(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+
+	submit := func(fields map[string]string, files map[string][2]string) (int, submissionResult) {
+		req := newSubmissionRequest(t, "/api/v1/submissions", fields, files)
+		req.Header.Set(uploadKeyHeader, "key")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		result := submissionResult{}
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	// empty submissions are rejected
+	if code, _ := submit(nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("Expected bad request for empty submission, got %d", code)
+	}
+
+	code, result := submit(nil, map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}})
+	if code != http.StatusCreated || len(result.Changed) != 1 || result.Changed[0] != partPoster {
+		t.Fatalf("Unexpected poster submission result %d: %+v", code, result)
+	}
+
+	// submitting only the video URL keeps the poster
+	code, result = submit(map[string]string{"video_url": "https://example.com/video"}, nil)
+	if code != http.StatusCreated {
+		t.Fatalf("Unexpected status code %d", code)
+	}
+	if len(result.Changed) != 1 || result.Changed[0] != partVideoURL {
+		t.Fatalf("Unexpected changed parts: %v", result.Changed)
+	}
+	if result.Poster == nil || result.Poster.SHA1 != sha1String("%PDF-1.4 test") {
+		t.Fatalf("Poster not kept: %+v", result.Poster)
+	}
+	// poster, check result, video URL and metadata
+	if err := checkDirFiles(uploader.Config().UploadDirectory, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := result.Parts()
+	if !parts[0].Present || parts[0].Changed || !parts[2].Changed || parts[1].Present {
+		t.Fatalf("Unexpected submission parts: %+v", parts)
+	}
+}
+
+func TestIdenticalResubmission(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	fields := map[string]string{"passcode": "key", "video_url": "https://example.com/video"}
+	uploader.Web.Router.ServeHTTP(httptest.NewRecorder(), newSubmissionRequest(t, "/submit", fields, files))
+	metaFile := filepath.Join(cfg.UploadDirectory, metadataName(cfg, "id"))
+	meta, err := ioutil.ReadFile(metaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// submitting the same poster and URL again does not create versions or
+	// rewrite the metadata
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, newSubmissionRequest(t, "/submit", fields, files))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "no change detected") {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	if data, err := ioutil.ReadFile(metaFile); err != nil || string(data) != string(meta) {
+		t.Fatalf("Metadata rewritten for unchanged submission: %s", data)
+	}
+	// poster, check result, video URL and metadata
+	if err := checkDirFiles(cfg.UploadDirectory, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the changed URL is rotated
+	fields["video_url"] = "https://example.com/new"
+	req := newSubmissionRequest(t, "/api/v1/submissions", fields, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	result := submissionResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid response %s: %v", w.Body.String(), err)
+	}
+	if len(result.Changed) != 1 || result.Changed[0] != partVideoURL || len(result.Unchanged) != 1 || result.Unchanged[0] != partPoster {
+		t.Fatalf("Unexpected submission result %+v", result)
+	}
+	if result.Poster == nil || result.Poster.SHA1 != sha1String("%PDF-1.4 test") {
+		t.Fatalf("Poster not kept: %+v", result.Poster)
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadExtensions(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.Videos = true
+
+	submit := func(files map[string][2]string) (int, []byte) {
+		req := newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+		req.Header.Set(uploadKeyHeader, "key")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		return w.Code, w.Body.Bytes()
+	}
+
+	// videos need a known extension
+	for _, name := range []string{"talk", "talk.txt"} {
+		if status, body := submit(map[string][2]string{"video": {name, "video"}}); status != http.StatusUnsupportedMediaType {
+			t.Errorf("Unexpected response for %q: %d %s", name, status, body)
+		}
+	}
+
+	status, body := submit(map[string][2]string{"poster": {"Poster.PDF", "%PDF-1.4 test"}, "video": {"TALK.MP4", "video"}})
+	result := submissionResult{}
+	if err := json.Unmarshal(body, &result); err != nil || status != http.StatusCreated {
+		t.Fatalf("Unexpected response %d: %s", status, body)
+	}
+	if result.Poster.Name != "id.pdf" || result.Video.Name != "id.mp4" {
+		t.Fatalf("Unexpected stored names %+v %+v", result.Poster, result.Video)
+	}
+
+	// other files of the poster are not taken for the video
+	if err := newStorage(cfg).Delete("id.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := newStorage(cfg).Save("id.txt", strings.NewReader("notes")); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := currentSubmission(cfg, &BCPoster{ID: "id"}); err != nil || current.Video != nil || current.Poster == nil {
+		t.Fatalf("Unexpected current submission %+v: %v", current, err)
+	}
+}
@@ -4,8 +4,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/mail"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"gopkg.in/yaml.v2"
 )
@@ -13,11 +21,86 @@ import (
 // Config represents the server configuration
 type Config struct {
 	// Port to listen on
-	Port uint16
+	Port uint16 `reload:"restart"`
+	// Address to bind to; empty listens on all interfaces
+	ListenAddress string `reload:"restart"`
+	// Unix socket path to listen on instead of the TCP address
+	UnixSocket string `reload:"restart"`
+	// Permissions of the Unix socket as an octal mode, e.g. "0660" to allow a reverse proxy in the same group; the umask applies if empty
+	UnixSocketMode string `reload:"restart"`
+	// TLS certificate file; TLS is enabled if both certificate and key are set
+	TLSCertFile string `reload:"restart"`
+	// TLS private key file
+	TLSKeyFile string `reload:"restart"`
+	// Storage backend for uploaded files: "filesystem" (uploaddirectory) or "s3"
+	Storage string `reload:"restart"`
 	// Directory for saving uploaded files
-	UploadDirectory string
+	UploadDirectory string `reload:"restart"`
+	// Layout of stored files: "flat" (<ID>.pdf, <ID>-v1.pdf) or "directories" (<ID>/current/, <ID>/versions/<time>/); change with --migrate-layout
+	StorageLayout string `reload:"restart"`
+	// S3 endpoint URL, e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000 for MinIO
+	S3Endpoint string `reload:"restart"`
+	// S3 region used for request signing
+	S3Region string `reload:"restart"`
+	// S3 bucket for uploaded files
+	S3Bucket string `reload:"restart"`
+	// S3 access key
+	S3AccessKey string `reload:"restart"`
+	// S3 secret key
+	S3SecretKey string `secret:"true" reload:"restart"`
+	// Directory withdrawn posters are moved to; must not be inside the upload directory
+	WithdrawnDirectory string
+	// File recording withdrawals and other changes to stored files
+	ManifestFile string
+	// Address of clamd for scanning uploaded files, a unix socket path or host:port; scanning is disabled if empty
+	ClamdAddress string
+	// Directory infected uploads are moved to; must not be inside the upload directory
+	QuarantineDirectory string
+	// Handling of uploads larger than the StreamMaxLength of clamd: "refuse" or "skip" scanning them
+	ScanOversize string
+	// Command probing uploaded videos for container, codecs and duration with an {input} placeholder, printing ffprobe JSON; disabled if empty
+	VideoProbeCommand string
+	// Maximum duration of uploaded videos in seconds; requires VideoProbeCommand; 0 disables the limit
+	VideoMaxDuration int
+	// Maximum size of uploaded videos in MiB; 0 disables the limit
+	VideoMaxSize uint64
+	// Maximum width and height of uploaded videos in pixels; require VideoProbeCommand; 0 disables the limit
+	VideoMaxWidth  int
+	VideoMaxHeight int
+	// Comma separated file extensions of accepted video containers, e.g. "mp4,mov"; all videos are accepted if empty
+	VideoFormats string
+	// True if uploaded video file names must follow the AbstractNumber_FirstAuthor naming scheme
+	VideoNaming bool
+	// Command converting videos to the standard MP4 profile with {input} and {output} placeholders; disabled if empty
+	TranscodeCommand string `reload:"restart"`
+	// Number of videos converted at the same time
+	TranscodeWorkers int `reload:"restart"`
+	// File storing pending video conversions
+	TranscodeQueueFile string `reload:"restart"`
+	// Minimum free space in MiB required in the upload directory; submissions which would leave less are refused; 0 disables the check
+	MinFreeSpace uint64
+	// Total size in MiB of all stored files including older versions; 0 disables the quota
+	StorageQuota uint64
+	// Size in MiB of the files of each poster including older versions; 0 disables the quota
+	PosterQuota uint64
+	// Git repository of the poster gallery accepted submissions are committed to, a local path or remote URL; publishing is disabled if empty
+	GalleryRepository string `reload:"restart"`
+	// Branch of the gallery repository
+	GalleryBranch string `reload:"restart"`
+	// SSH private key for pushing to the gallery repository; the default ssh configuration is used if empty
+	GallerySSHKey string
+	// Author of gallery repository commits as "Name <email>"
+	GalleryCommitAuthor string
+	// Local clone of the gallery repository used for committing; must not be inside the upload directory
+	PublishWorkDirectory string `reload:"restart"`
+	// File persisting the queue of posters waiting to be published
+	PublishQueueFile string `reload:"restart"`
+	// Number of attempts to publish a poster before giving up until it is requeued
+	PublishAttempts int
 	// File containing user info with passwords
 	PostersInfoFile string
+	// Comma separated field=column pairs mapping columns of imported CSV or keys of imported JSON posters files to poster fields, e.g. "AbstractNumber=Abstract No."
+	PostersColumns string
 	// True if video upload is enabled
 	Videos bool
 	// Alternative video upload url
@@ -26,8 +109,48 @@ type Config struct {
 	ConferencePageURL string
 	// Support email address displayed on the page
 	SupportEmail string
-	// Number of file versions to keep
+	// Directory containing custom page templates; built-in templates are used for missing files
+	ThemeDirectory string `reload:"restart"`
+	// Language used if the browser does not request a supported language (en, de)
+	DefaultLanguage string
+	// Conference name displayed on all pages
+	ConferenceName string
+	// Conference description displayed when the submission is closed
+	ConferenceDescription string
+	// URL of the poster gallery linked in the page header
+	GalleryURL string
+	// Banner image displayed when the submission is closed
+	BannerImage string
+	// URL of the conference video channel; video channel instructions are hidden if empty
+	VideoChannelURL string
+	// Twitter account used in the page meta data
+	TwitterSite string
+	// Copyright year(s) displayed in the footer
+	CopyrightYear string
+	// Copyright holder displayed in the footer
+	CopyrightHolder string
+	// Copyright holder URL
+	CopyrightHolderURL string
+	// Copyright holder logo displayed in the footer
+	CopyrightHolderLogo string
+	// Additional links displayed in the footer
+	FooterLinks []FooterLink
+	// Number of file versions to keep including the current file; 0 keeps all versions
 	KeepVersions int
+	// Days after which older file versions are deleted; 0 keeps them regardless of age
+	KeepVersionsDays int
+	// Format of the metadata file stored with each poster: json or yaml
+	MetadataFormat string
+	// Also store a README.md for each poster rendered from the readme template
+	MetadataReadme bool
+	// Command rendering poster previews with {input}, {output}, {outputbase} and {width} placeholders; disabled if empty
+	PreviewCommand string
+	// Command printing the text of the first page of a PDF with {input} placeholder; disabled if empty
+	PDFTextCommand string
+	// Width in pixels of poster thumbnails
+	ThumbnailWidth int
+	// Width in pixels of poster previews
+	PreviewWidth int
 	// Date as YYYY-MM-DD string when the poster submission is closed
 	SubmissionClosedDate string
 	// Text when the poster submission is closed
@@ -37,46 +160,458 @@ type Config struct {
 	// File whitelisted email addresses can be uploaded to
 	WhitelistFile string
 	// Password for whitelist email address upload
-	WhitelistPW string
+	WhitelistPW string `secret:"true"`
+	// User name for the admin interface
+	AdminUser string
+	// Password for the admin interface; the admin interface is disabled if empty
+	AdminPW string `secret:"true"`
 }
 
+// defaultWhitelistPW is the random whitelist password used if none is
+// configured. It is generated once, so all default configurations of a
+// process are equal and the value is not reported as changed. As it is
+// redacted like all secrets, a warning is logged at startup if it is used.
+var defaultWhitelistPW = fmt.Sprint(time.Now().UnixNano())
+
 func defaultConfig() *Config {
 	return &Config{
-		Port:                      3000,
-		UploadDirectory:           "uploads",
-		PostersInfoFile:           "posters.json",
-		Videos:                    false,
-		VideoUploadURL:            "",
-		ConferencePageURL:         "https://www.bernstein-network.de/en/bernstein-conference/",
-		SupportEmail:              "bernstein.conference@fz-juelich.de",
+		Port:                 3000,
+		ListenAddress:        "",
+		UnixSocket:           "",
+		UnixSocketMode:       "",
+		TLSCertFile:          "",
+		TLSKeyFile:           "",
+		Storage:              storageFilesystem,
+		UploadDirectory:      "uploads",
+		StorageLayout:        layoutFlat,
+		S3Endpoint:           "",
+		S3Region:             "us-east-1",
+		S3Bucket:             "",
+		S3AccessKey:          "",
+		S3SecretKey:          "",
+		WithdrawnDirectory:   "withdrawn",
+		ManifestFile:         "manifest.jsonl",
+		ClamdAddress:         "",
+		QuarantineDirectory:  "quarantine",
+		ScanOversize:         scanOversizeRefuse,
+		VideoProbeCommand:    "ffprobe -v error -print_format json -show_format -show_streams {input}",
+		VideoMaxDuration:     0,
+		VideoMaxSize:         0,
+		VideoMaxWidth:        0,
+		VideoMaxHeight:       0,
+		VideoFormats:         "",
+		VideoNaming:          false,
+		TranscodeCommand:     "ffmpeg -v error -y -i {input} -c:v libx264 -preset medium -crf 23 -pix_fmt yuv420p -c:a aac -b:a 128k -movflags +faststart {output}",
+		TranscodeWorkers:     2,
+		TranscodeQueueFile:   "transcode-queue.json",
+		MinFreeSpace:         100,
+		StorageQuota:         0,
+		PosterQuota:          0,
+		GalleryRepository:    "",
+		GalleryBranch:        "master",
+		GallerySSHKey:        "",
+		GalleryCommitAuthor:  "Poster Uploader <uploader@localhost>",
+		PublishWorkDirectory: "gallery",
+		PublishQueueFile:     "publish-queue.json",
+		PublishAttempts:      5,
+		PostersInfoFile:      "posters.json",
+		PostersColumns:       "",
+		Videos:               false,
+		VideoUploadURL:       "",
+		ConferencePageURL:    "https://www.bernstein-network.de/en/bernstein-conference/",
+		SupportEmail:         "bernstein.conference@fz-juelich.de",
+		ThemeDirectory:       "",
+		DefaultLanguage:      defaultLanguage,
+		ConferenceName:       "Bernstein Conference",
+		ConferenceDescription: "Each year the Bernstein Network invites the international computational neuroscience community to the annual " +
+			"Bernstein Conference for intensive scientific exchange. It has established itself as one of the most renown " +
+			"conferences worldwide in this field, attracting students, postdocs and PIs from around the world to meet and " +
+			"discuss new scientific discoveries.",
+		GalleryURL:          "https://posters.bc.g-node.org",
+		BannerImage:         "/assets/BC_online_header.jpeg",
+		VideoChannelURL:     "https://vimeo.com/bernsteinnetwork",
+		TwitterSite:         "@nncn_germany",
+		CopyrightYear:       "2020-2022",
+		CopyrightHolder:     "G-Node",
+		CopyrightHolderURL:  "http://www.g-node.org",
+		CopyrightHolderLogo: "https://projects.g-node.org/assets/gnode-bootstrap-theme/1.2.0-snapshot/img/gnode-icon-50x50-transparent.png",
+		FooterLinks: []FooterLink{
+			{
+				Name:  "Terms of Use",
+				URL:   "https://bc.g-node.org/G-Node/Info/wiki/Terms+of+Use",
+				Names: map[string]string{"de": "Nutzungsbedingungen"},
+			},
+			{
+				Name:  "Privacy Policy",
+				URL:   "https://bc.g-node.org/G-Node/Info/wiki/Datenschutz",
+				Names: map[string]string{"de": "Datenschutz"},
+			},
+			{
+				Name:  "Imprint",
+				URL:   "https://bc.g-node.org/G-Node/Info/wiki/imprint",
+				Names: map[string]string{"de": "Impressum"},
+			},
+		},
 		KeepVersions:              5,
+		MetadataFormat:            metadataJSON,
+		MetadataReadme:            false,
+		PreviewCommand:            "pdftoppm -png -singlefile -f 1 -l 1 -scale-to {width} {input} {outputbase}",
+		PDFTextCommand:            "pdftotext -f 1 -l 1 -enc UTF-8 {input} -",
+		ThumbnailWidth:            300,
+		PreviewWidth:              1200,
 		SubmissionClosedDate:      "2100-12-31",
 		SubmissionClosedText:      "Sunday, Sep 19, 2021, 8 pm CEST",
 		SubmissionClosedVideoText: "Friday, Sep 17, 1 pm CEST",
 		WhitelistFile:             "whitelist.txt",
-		WhitelistPW:               fmt.Sprint(time.Now().UnixNano()),
+		WhitelistPW:               defaultWhitelistPW,
+		AdminUser:                 "admin",
+		AdminPW:                   "",
+	}
+}
+
+// envPrefix is the prefix of environment variables overriding
+// configuration values, e.g. UPLOADER_UPLOAD_DIRECTORY for UploadDirectory.
+const envPrefix = "UPLOADER_"
+
+// configErrors collects all problems found while loading or validating
+// the configuration so they can be reported at once.
+type configErrors []string
+
+func (errs configErrors) Error() string {
+	return fmt.Sprintf("%d configuration problem(s):\n  - %s", len(errs), strings.Join(errs, "\n  - "))
+}
+
+func (errs *configErrors) add(format string, args ...interface{}) {
+	*errs = append(*errs, fmt.Sprintf(format, args...))
+}
+
+// loadConfig reads the configuration file on top of the default values
+// and applies environment variable overrides. Unknown keys in the file
+// are reported as errors. If required is false, a missing configuration
+// file is not an error and only defaults and environment are used.
+func loadConfig(configFileName string, required bool) (*Config, error) {
+	config := defaultConfig() // set defaults first
+	data, err := ioutil.ReadFile(configFileName)
+	if os.IsNotExist(err) && !required {
+		log.Printf("Config file %q not found; using defaults and environment", configFileName)
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading config file %q: %v", configFileName, err)
+	} else if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %q: %v", configFileName, err)
+	}
+
+	if err := config.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// envName returns the environment variable name for a Config field by
+// converting the CamelCase field name to upper snake case.
+func envName(field string) string {
+	runes := []rune(field)
+	var name strings.Builder
+	for idx, r := range runes {
+		if idx > 0 && unicode.IsUpper(r) {
+			prev := runes[idx-1]
+			nextLower := idx+1 < len(runes) && unicode.IsLower(runes[idx+1])
+			if unicode.IsLower(prev) || (unicode.IsUpper(prev) && nextLower) {
+				name.WriteRune('_')
+			}
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return envPrefix + name.String()
+}
+
+// applyEnv overrides configuration values with the values of UPLOADER_*
+// environment variables returned by lookup.
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs configErrors
+	cfgValue := reflect.ValueOf(cfg).Elem()
+	cfgType := cfgValue.Type()
+	for idx := 0; idx < cfgType.NumField(); idx++ {
+		name := envName(cfgType.Field(idx).Name)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		field := cfgValue.Field(idx)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs.add("%s: invalid boolean %q", name, value)
+				continue
+			}
+			field.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+			if err != nil {
+				errs.add("%s: invalid integer %q", name, value)
+				continue
+			}
+			field.SetInt(n)
+		case reflect.Uint16, reflect.Uint64:
+			n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+			if err != nil {
+				errs.add("%s: invalid unsigned integer %q", name, value)
+				continue
+			}
+			field.SetUint(n)
+		default:
+			errs.add("%s: overriding %s values is not supported", name, field.Kind())
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks all configuration values and returns a configErrors
+// value listing every problem found, or nil if the configuration is valid.
+func (cfg *Config) Validate() error {
+	var errs configErrors
+
+	if cfg.Port == 0 && cfg.UnixSocket == "" {
+		errs.add("port: must be set unless unixsocket is used")
+	}
+	if _, err := socketMode(cfg); err != nil {
+		errs.add("unixsocketmode: %v", err)
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		errs.add("tlscertfile, tlskeyfile: both or neither must be set")
+	}
+	for key, fname := range map[string]string{"tlscertfile": cfg.TLSCertFile, "tlskeyfile": cfg.TLSKeyFile} {
+		if fname == "" {
+			continue
+		}
+		if _, err := os.Stat(fname); err != nil {
+			errs.add("%s: %v", key, err)
+		}
+	}
+
+	if cfg.UploadDirectory == "" {
+		errs.add("uploaddirectory: must not be empty")
+	} else if info, err := os.Stat(cfg.UploadDirectory); err == nil && !info.IsDir() {
+		errs.add("uploaddirectory: %s is not a directory", cfg.UploadDirectory)
+	}
+
+	switch cfg.Storage {
+	case storageFilesystem:
+	case storageS3:
+		if u, err := url.Parse(cfg.S3Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			errs.add("s3endpoint: %q is not an absolute URL", cfg.S3Endpoint)
+		}
+		for key, value := range map[string]string{"s3region": cfg.S3Region, "s3bucket": cfg.S3Bucket, "s3accesskey": cfg.S3AccessKey, "s3secretkey": cfg.S3SecretKey} {
+			if value == "" {
+				errs.add("%s: must not be empty for s3 storage", key)
+			}
+		}
+	default:
+		errs.add("storage: unsupported storage backend %q (filesystem, s3)", cfg.Storage)
+	}
+
+	if cfg.StorageLayout != layoutFlat && cfg.StorageLayout != layoutDirectories {
+		errs.add("storagelayout: unsupported layout %q (%s, %s)", cfg.StorageLayout, layoutFlat, layoutDirectories)
+	}
+
+	if cfg.WithdrawnDirectory == "" {
+		errs.add("withdrawndirectory: must not be empty")
+	} else if isSubdir(cfg.UploadDirectory, cfg.WithdrawnDirectory) {
+		errs.add("withdrawndirectory: must not be inside the publicly served upload directory")
+	}
+	if cfg.ManifestFile == "" {
+		errs.add("manifestfile: must not be empty")
+	} else if isSubdir(cfg.UploadDirectory, cfg.ManifestFile) {
+		errs.add("manifestfile: must not be inside the publicly served upload directory")
+	}
+
+	if cfg.QuarantineDirectory == "" {
+		errs.add("quarantinedirectory: must not be empty")
+	} else if isSubdir(cfg.UploadDirectory, cfg.QuarantineDirectory) {
+		errs.add("quarantinedirectory: must not be inside the publicly served upload directory")
+	}
+	if cfg.ScanOversize != scanOversizeRefuse && cfg.ScanOversize != scanOversizeSkip {
+		errs.add("scanoversize: must be %q or %q (got %q)", scanOversizeRefuse, scanOversizeSkip, cfg.ScanOversize)
+	}
+
+	if cfg.GalleryRepository != "" {
+		if cfg.GalleryBranch == "" {
+			errs.add("gallerybranch: must not be empty if publishing is enabled")
+		}
+		if _, err := mail.ParseAddress(cfg.GalleryCommitAuthor); err != nil {
+			errs.add("gallerycommitauthor: %q is not of the form \"Name <email>\"", cfg.GalleryCommitAuthor)
+		}
+		if cfg.PublishWorkDirectory == "" {
+			errs.add("publishworkdirectory: must not be empty if publishing is enabled")
+		} else if isSubdir(cfg.UploadDirectory, cfg.PublishWorkDirectory) {
+			errs.add("publishworkdirectory: must not be inside the publicly served upload directory")
+		}
+		if cfg.PublishQueueFile == "" {
+			errs.add("publishqueuefile: must not be empty if publishing is enabled")
+		} else if isSubdir(cfg.UploadDirectory, cfg.PublishQueueFile) {
+			errs.add("publishqueuefile: must not be inside the publicly served upload directory")
+		}
+		if cfg.PublishAttempts < 1 {
+			errs.add("publishattempts: must be at least 1 (got %d)", cfg.PublishAttempts)
+		}
+	}
+
+	if cfg.PostersInfoFile == "" {
+		errs.add("postersinfofile: must not be empty")
+	} else if _, err := loadUserList(cfg.PostersInfoFile); err != nil {
+		errs.add("postersinfofile: %v", err)
+	}
+	if _, err := parsePosterColumns(cfg.PostersColumns); err != nil {
+		errs.add("posterscolumns: %v", err)
+	}
+
+	urls := map[string]string{
+		"videouploadurl":     cfg.VideoUploadURL,
+		"conferencepageurl":  cfg.ConferencePageURL,
+		"galleryurl":         cfg.GalleryURL,
+		"videochannelurl":    cfg.VideoChannelURL,
+		"copyrightholderurl": cfg.CopyrightHolderURL,
+	}
+	for key, value := range urls {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			errs.add("%s: %q is not an absolute URL", key, value)
+		}
+	}
+
+	if cfg.SupportEmail == "" {
+		errs.add("supportemail: must not be empty")
+	} else if _, err := mail.ParseAddress(cfg.SupportEmail); err != nil {
+		errs.add("supportemail: %q is not a valid email address", cfg.SupportEmail)
 	}
+
+	if messages[cfg.DefaultLanguage] == nil {
+		errs.add("defaultlanguage: unsupported language %q", cfg.DefaultLanguage)
+	}
+	if cfg.ConferenceName == "" {
+		errs.add("conferencename: must not be empty")
+	}
+	for idx, link := range cfg.FooterLinks {
+		if link.Name == "" || link.URL == "" {
+			errs.add("footerlinks: entry %d requires name and url", idx+1)
+		}
+	}
+	if cfg.ThemeDirectory != "" {
+		if info, err := os.Stat(cfg.ThemeDirectory); err != nil {
+			errs.add("themedirectory: %v", err)
+		} else if !info.IsDir() {
+			errs.add("themedirectory: %s is not a directory", cfg.ThemeDirectory)
+		} else if _, err := loadTemplates(cfg.ThemeDirectory); err != nil {
+			errs.add("themedirectory: %v", err)
+		}
+	}
+
+	if cfg.KeepVersions < 0 {
+		errs.add("keepversions: must not be negative (got %d)", cfg.KeepVersions)
+	}
+	if cfg.KeepVersionsDays < 0 {
+		errs.add("keepversionsdays: must not be negative (got %d)", cfg.KeepVersionsDays)
+	}
+
+	if cfg.MetadataFormat != metadataJSON && cfg.MetadataFormat != metadataYAML {
+		errs.add("metadataformat: unsupported format %q (json, yaml)", cfg.MetadataFormat)
+	}
+
+	if cfg.PreviewCommand != "" && !strings.Contains(cfg.PreviewCommand, "{input}") {
+		errs.add("previewcommand: must contain the {input} placeholder")
+	}
+	if cfg.PDFTextCommand != "" && !strings.Contains(cfg.PDFTextCommand, "{input}") {
+		errs.add("pdftextcommand: must contain the {input} placeholder")
+	}
+	if cfg.VideoProbeCommand != "" && !strings.Contains(cfg.VideoProbeCommand, "{input}") {
+		errs.add("videoprobecommand: must contain the {input} placeholder")
+	}
+	if cfg.VideoMaxDuration < 0 {
+		errs.add("videomaxduration: must not be negative (got %d)", cfg.VideoMaxDuration)
+	}
+	if cfg.VideoMaxWidth < 0 || cfg.VideoMaxHeight < 0 {
+		errs.add("videomaxwidth, videomaxheight: must not be negative (got %dx%d)", cfg.VideoMaxWidth, cfg.VideoMaxHeight)
+	}
+	for _, format := range cfg.videoFormats() {
+		if strings.ContainsAny(format, "./") {
+			errs.add("videoformats: %q is not a file extension without dot", format)
+		}
+	}
+	if cfg.TranscodeCommand != "" {
+		if !strings.Contains(cfg.TranscodeCommand, "{input}") || !strings.Contains(cfg.TranscodeCommand, "{output}") {
+			errs.add("transcodecommand: must contain the {input} and {output} placeholders")
+		}
+		if cfg.TranscodeWorkers < 1 {
+			errs.add("transcodeworkers: must be positive (got %d)", cfg.TranscodeWorkers)
+		}
+		if cfg.TranscodeQueueFile == "" {
+			errs.add("transcodequeuefile: must not be empty if transcoding is enabled")
+		}
+	}
+	if cfg.ThumbnailWidth <= 0 {
+		errs.add("thumbnailwidth: must be positive (got %d)", cfg.ThumbnailWidth)
+	}
+	if cfg.PreviewWidth <= 0 {
+		errs.add("previewwidth: must be positive (got %d)", cfg.PreviewWidth)
+	}
+
+	if _, err := time.Parse("2006-01-02", cfg.SubmissionClosedDate); err != nil {
+		errs.add("submissioncloseddate: %q is not a YYYY-MM-DD date", cfg.SubmissionClosedDate)
+	}
+
+	if cfg.WhitelistFile == "" {
+		errs.add("whitelistfile: must not be empty")
+	}
+	if cfg.WhitelistPW == "" {
+		errs.add("whitelistpw: must not be empty")
+	}
+	if cfg.AdminPW != "" && cfg.AdminUser == "" {
+		errs.add("adminuser: must not be empty if adminpw is set")
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errs
+	}
+	return nil
 }
 
-func readConfig(configFileName string) *Config {
-	configFile, err := os.Open(configFileName)
+// isSubdir returns true if path is dir or located inside dir.
+func isSubdir(dir, path string) bool {
+	absDir, err := filepath.Abs(dir)
 	if err != nil {
-		log.Printf("[os.Open] Error reading config file %q: %s", configFileName, err.Error())
-		os.Exit(1)
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
 	}
-	defer configFile.Close()
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
 
-	data, err := ioutil.ReadAll(configFile)
+// readConfig loads and validates the configuration and creates the upload
+// directory. The program exits if the configuration cannot be used.
+func readConfig(configFileName string, required bool) *Config {
+	config, err := loadConfig(configFileName, required)
 	if err != nil {
-		log.Printf("[ioutil.ReadAll] Error reading config file %q: %s", configFileName, err.Error())
+		log.Print(err.Error())
 		os.Exit(1)
 	}
-
-	config := defaultConfig() // set defaults first
-	if err := yaml.Unmarshal(data, config); err != nil {
-		log.Printf("[yaml.Unmarshall] Error reading config file (%q): %s", configFileName, err.Error())
+	if err := config.Validate(); err != nil {
+		log.Printf("Invalid configuration: %s", err.Error())
 		os.Exit(1)
 	}
+	if config.Storage != storageFilesystem {
+		return config
+	}
 	// create upload directory (if it doesn't exist)
 	err = os.MkdirAll(config.UploadDirectory, 0777)
 	if err != nil {
@@ -86,6 +621,52 @@ func readConfig(configFileName string) *Config {
 	return config
 }
 
+// checkConfig loads and validates the configuration, prints the result
+// and returns the exit code for the --check-config mode.
+func checkConfig(configFileName string, required bool) int {
+	config, err := loadConfig(configFileName, required)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	fmt.Println("Configuration OK")
+	return 0
+}
+
+// migrateConfiguredStorage moves the stored files of the configured storage
+// to the provided layout and returns the exit code for the
+// --migrate-layout mode.
+func migrateConfiguredStorage(configFileName string, required bool, layout string) int {
+	config := readConfig(configFileName, required)
+	moved, err := migrateLayout(newBackend(config), layout)
+	fmt.Printf("%d files moved to the %s layout\n", moved, layout)
+	if err != nil {
+		fmt.Printf("Error migrating storage: %s\n", err.Error())
+		return 1
+	}
+	if config.StorageLayout != layout {
+		fmt.Printf("Set storagelayout to %q in the configuration before starting the server\n", layout)
+	}
+	return 0
+}
+
+// pruneConfiguredStorage deletes the older versions of all stored files
+// exceeding the configured retention and returns the exit code.
+func pruneConfiguredStorage(configFileName string, required bool) int {
+	config := readConfig(configFileName, required)
+	deleted, err := pruneAllVersions(config)
+	fmt.Printf("%d older versions deleted\n", deleted)
+	if err != nil {
+		fmt.Printf("Error pruning versions: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
+
 // writeConfig writes the default configuration values to the specified file.
 func writeConfig(cfgFileName string) {
 	// using fmt.Print for error messages here since it's run interactively and
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	names := map[string]string{
+		"Port":                 "UPLOADER_PORT",
+		"UploadDirectory":      "UPLOADER_UPLOAD_DIRECTORY",
+		"TLSCertFile":          "UPLOADER_TLS_CERT_FILE",
+		"VideoUploadURL":       "UPLOADER_VIDEO_UPLOAD_URL",
+		"WhitelistPW":          "UPLOADER_WHITELIST_PW",
+		"SubmissionClosedDate": "UPLOADER_SUBMISSION_CLOSED_DATE",
+	}
+	for field, expected := range names {
+		if name := envName(field); name != expected {
+			t.Fatalf("Unexpected env name for %s: %q != %q", field, name, expected)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"UPLOADER_PORT":             "8080",
+		"UPLOADER_VIDEOS":           "true",
+		"UPLOADER_KEEP_VERSIONS":    "2",
+		"UPLOADER_UPLOAD_DIRECTORY": "/data",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	cfg := defaultConfig()
+	if err := cfg.applyEnv(lookup); err != nil {
+		t.Fatalf("Error applying environment: %v", err)
+	}
+	if cfg.Port != 8080 || !cfg.Videos || cfg.KeepVersions != 2 || cfg.UploadDirectory != "/data" {
+		t.Fatalf("Environment not applied: %+v", cfg)
+	}
+
+	env = map[string]string{
+		"UPLOADER_PORT":   "99999",
+		"UPLOADER_VIDEOS": "maybe",
+	}
+	err := defaultConfig().applyEnv(lookup)
+	if errs, ok := err.(configErrors); !ok || len(errs) != 2 {
+		t.Fatalf("Expected two errors for invalid environment values, got: %v", err)
+	}
+}
+
+func TestLoadConfigStrict(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_config")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgFile := filepath.Join(tmpDir, "config")
+	if err := ioutil.WriteFile(cfgFile, []byte("port: 4000\nkeepversion: 3\n"), 0644); err != nil {
+		t.Fatalf("Error writing config file: %v", err)
+	}
+	_, err = loadConfig(cfgFile, true)
+	if err == nil || !strings.Contains(err.Error(), "keepversion") {
+		t.Fatalf("Expected unknown key error, got: %v", err)
+	}
+
+	// missing optional file falls back to defaults
+	cfg, err := loadConfig(filepath.Join(tmpDir, "missing"), false)
+	if err != nil {
+		t.Fatalf("Unexpected error for missing optional config: %v", err)
+	}
+	if cfg.Port != defaultConfig().Port {
+		t.Fatalf("Unexpected port: %d", cfg.Port)
+	}
+	if _, err := loadConfig(filepath.Join(tmpDir, "missing"), true); err == nil {
+		t.Fatal("Expected error for missing required config")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_validate")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	postersFile := filepath.Join(tmpDir, "posters.json")
+	if err := ioutil.WriteFile(postersFile, []byte("[]"), 0644); err != nil {
+		t.Fatalf("Error writing posters file: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.UploadDirectory = tmpDir
+	cfg.PostersInfoFile = postersFile
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	cfg.KeepVersions = -1
+	cfg.SubmissionClosedDate = "31.12.2100"
+	cfg.PostersInfoFile = filepath.Join(tmpDir, "missing.json")
+	cfg.TLSCertFile = "cert.pem"
+	cfg.UnixSocketMode = "rw"
+	cfg.WhitelistPW = ""
+	err = cfg.Validate()
+	errs, ok := err.(configErrors)
+	if !ok {
+		t.Fatalf("Expected configErrors, got: %v", err)
+	}
+	for _, key := range []string{"keepversions", "submissioncloseddate", "postersinfofile", "tlscertfile", "unixsocketmode", "whitelistpw"} {
+		found := false
+		for _, e := range errs {
+			if strings.HasPrefix(e, key) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("Missing error for %s in: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// redacted replaces the value of secret configuration fields in any output.
+const redacted = "********"
+
+// configField is a single configuration value as displayed to operators.
+type configField struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Secret bool        `json:"secret,omitempty"`
+}
+
+// configKey returns the YAML key of a Config field.
+func configKey(field reflect.StructField) string {
+	return strings.ToLower(field.Name)
+}
+
+// fields returns all configuration values in declaration order. Fields
+// tagged with `secret:"true"` are redacted unless they are empty.
+func (cfg *Config) fields() []configField {
+	cfgValue := reflect.ValueOf(cfg).Elem()
+	cfgType := cfgValue.Type()
+	fields := make([]configField, 0, cfgType.NumField())
+	for idx := 0; idx < cfgType.NumField(); idx++ {
+		structField := cfgType.Field(idx)
+		field := configField{
+			Key:    configKey(structField),
+			Value:  cfgValue.Field(idx).Interface(),
+			Secret: structField.Tag.Get("secret") == "true",
+		}
+		if field.Secret && !cfgValue.Field(idx).IsZero() {
+			field.Value = redacted
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// String returns the configuration with all secret values redacted. It is
+// also used when the configuration is printed with the %v verbs.
+func (cfg *Config) String() string {
+	items := make([]string, 0)
+	for _, field := range cfg.fields() {
+		items = append(items, fmt.Sprintf("%s:%v", field.Key, field.Value))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(items, " "))
+}
+
+// configChange describes a configuration value that differs between two
+// configurations, e.g. the defaults and the active configuration.
+type configChange struct {
+	Key  string      `json:"key"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// diffConfig returns all values of cfg which differ from defaults. Secret
+// values are redacted in both the default and the configured value.
+func diffConfig(defaults, cfg *Config) []configChange {
+	defaultFields := defaults.fields()
+	cfgFields := cfg.fields()
+	defaultValue := reflect.ValueOf(defaults).Elem()
+	cfgValue := reflect.ValueOf(cfg).Elem()
+	changes := make([]configChange, 0)
+	for idx := range cfgFields {
+		// compare the actual values; redacted values may look identical
+		if reflect.DeepEqual(defaultValue.Field(idx).Interface(), cfgValue.Field(idx).Interface()) {
+			continue
+		}
+		changes = append(changes, configChange{
+			Key:  cfgFields[idx].Key,
+			From: defaultFields[idx].Value,
+			To:   cfgFields[idx].Value,
+		})
+	}
+	return changes
+}
+
+// formatChanges returns a printable list of configuration changes.
+func formatChanges(changes []configChange) string {
+	if len(changes) == 0 {
+		return "none"
+	}
+	lines := make([]string, len(changes))
+	for idx, change := range changes {
+		lines[idx] = fmt.Sprintf("%s: %v -> %v", change.Key, change.From, change.To)
+	}
+	return strings.Join(lines, "; ")
+}
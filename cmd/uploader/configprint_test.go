@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigRedacted(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.WhitelistPW = "whitelistsecret"
+	cfg.AdminPW = "adminsecret"
+
+	for _, out := range []string{cfg.String(), fmt.Sprintf("%+v", cfg), fmt.Sprintf("%v", cfg)} {
+		if strings.Contains(out, "whitelistsecret") || strings.Contains(out, "adminsecret") {
+			t.Fatalf("Secret value in config output: %s", out)
+		}
+		if !strings.Contains(out, "whitelistpw:"+redacted) {
+			t.Fatalf("Redacted value missing in config output: %s", out)
+		}
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	defaults := defaultConfig()
+	cfg := defaultConfig()
+	if changes := diffConfig(defaults, cfg); len(changes) != 0 {
+		t.Fatalf("Unexpected changes: %+v", changes)
+	}
+
+	cfg.Port = 4000
+	cfg.AdminPW = "adminsecret"
+	changes := diffConfig(defaults, cfg)
+	if len(changes) != 2 {
+		t.Fatalf("Unexpected number of changes: %+v", changes)
+	}
+	if changes[0].Key != "port" || changes[0].To != uint16(4000) {
+		t.Fatalf("Unexpected port change: %+v", changes[0])
+	}
+	if changes[1].Key != "adminpw" || changes[1].To != redacted {
+		t.Fatalf("Unexpected admin password change: %+v", changes[1])
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	cfg := defaultConfig()
+	uploader := NewUploader(cfg)
+
+	// admin interface disabled without password
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/config", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected disabled admin interface, got status %d", w.Code)
+	}
+
+	cfg.AdminPW = "adminsecret"
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/admin/config", nil)
+	req.SetBasicAuth("admin", "wrong")
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected unauthorised status, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/admin/config", nil)
+	req.SetBasicAuth("admin", "adminsecret")
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "adminsecret") || strings.Contains(body, cfg.WhitelistPW) {
+		t.Fatalf("Secret value in admin config output: %s", body)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "fmt"
+
+// freeSpace is not supported on this platform and always returns an error.
+func freeSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("free space check not supported on this platform")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// healthCheck is the result of a single readiness check.
+type healthCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// healthStatus is the JSON document returned by the health and
+// readiness endpoints.
+type healthStatus struct {
+	Status  string        `json:"status"`
+	Version string        `json:"version"`
+	Checks  []healthCheck `json:"checks,omitempty"`
+}
+
+// writeJSON writes the provided value as JSON with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+// healthz reports that the process is up and serving requests.
+func (uploader *Uploader) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ok", Version: verstr})
+}
+
+// readyz runs all readiness checks and reports their results. The
+// response status is 503 if any of the checks failed.
+func (uploader *Uploader) readyz(w http.ResponseWriter, r *http.Request) {
+	checks := uploader.readinessChecks()
+	status := healthStatus{Status: "ok", Version: verstr, Checks: checks}
+	code := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			log.Printf("Readiness check %q failed: %s", check.Name, check.Message)
+		}
+	}
+	writeJSON(w, code, status)
+}
+
+// readinessChecks runs all checks required for the service to accept
+// submissions.
+func (uploader *Uploader) readinessChecks() []healthCheck {
+	cfg := uploader.Config()
+	storageCheck := newHealthCheck("upload_directory", checkUploadDirectory(cfg.UploadDirectory, cfg.MinFreeSpace))
+	if cfg.Storage != storageFilesystem {
+		storageCheck = newHealthCheck("storage", checkStorage(newStorage(cfg)))
+	}
+	return []healthCheck{
+		storageCheck,
+		newHealthCheck("posters_info_file", checkPostersInfo(cfg.PostersInfoFile)),
+		newHealthCheck("whitelist_file", checkWhitelistFile(cfg.WhitelistFile)),
+		newHealthCheck("clamd", checkClamd(cfg.ClamdAddress)),
+	}
+}
+
+func newHealthCheck(name string, err error) healthCheck {
+	check := healthCheck{Name: name, OK: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	return check
+}
+
+// checkUploadDirectory verifies that files can be created in the upload
+// directory and that at least minFreeMiB MiB are available.
+func checkUploadDirectory(dir string, minFreeMiB uint64) error {
+	tmpfile, err := ioutil.TempFile(dir, ".readyz-")
+	if err != nil {
+		return fmt.Errorf("directory is not writable: %v", err)
+	}
+	tmpfile.Close()
+	if err := os.Remove(tmpfile.Name()); err != nil {
+		return fmt.Errorf("failed to remove test file: %v", err)
+	}
+
+	if minFreeMiB == 0 {
+		return nil
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		return fmt.Errorf("failed to determine free space: %v", err)
+	}
+	if free < minFreeMiB*1024*1024 {
+		return fmt.Errorf("only %d MiB free, %d MiB required", free/1024/1024, minFreeMiB)
+	}
+	return nil
+}
+
+// checkStorage verifies that a remote storage backend can be accessed.
+func checkStorage(store storage) error {
+	_, err := store.List(".readyz")
+	return err
+}
+
+// checkPostersInfo verifies that the posters info file can be loaded.
+func checkPostersInfo(fname string) error {
+	posters, err := loadUserList(fname)
+	if err != nil {
+		return err
+	}
+	if len(posters) == 0 {
+		return fmt.Errorf("no posters found in %s", fname)
+	}
+	return nil
+}
+
+// checkWhitelistFile verifies that the whitelist file can be read. Since
+// the file is created on the first upload, a missing file is accepted as
+// long as its directory exists.
+func checkWhitelistFile(fname string) error {
+	file, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		dir := filepath.Dir(fname)
+		if info, err := os.Stat(dir); err != nil {
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return file.Close()
+}
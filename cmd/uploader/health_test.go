@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	uploader := NewUploader(defaultConfig())
+	w := httptest.NewRecorder()
+	uploader.healthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Invalid status code: %d", w.Code)
+	}
+	status := healthStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if status.Version != verstr {
+		t.Fatalf("Unexpected version: %q", status.Version)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_readyz")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := defaultConfig()
+	cfg.UploadDirectory = tmpDir
+	cfg.MinFreeSpace = 0
+	cfg.PostersInfoFile = filepath.Join(tmpDir, "posters.json")
+	cfg.WhitelistFile = filepath.Join(tmpDir, "whitelist.txt")
+	uploader := NewUploader(cfg)
+
+	readyz := func() healthStatus {
+		w := httptest.NewRecorder()
+		uploader.readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+		status := healthStatus{}
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("Invalid JSON response: %v", err)
+		}
+		if (status.Status == "ok") != (w.Code == http.StatusOK) {
+			t.Fatalf("Status %q does not match status code %d", status.Status, w.Code)
+		}
+		return status
+	}
+
+	// posters file missing
+	status := readyz()
+	if status.Status == "ok" {
+		t.Fatal("Expected readiness failure with missing posters file")
+	}
+	for _, check := range status.Checks {
+		if check.OK == (check.Name == "posters_info_file") {
+			t.Fatalf("Unexpected result for check %+v", check)
+		}
+	}
+
+	posters := `[{"ID": "id", "upload_key": "key"}]`
+	if err := ioutil.WriteFile(cfg.PostersInfoFile, []byte(posters), 0644); err != nil {
+		t.Fatalf("Error writing posters file: %v", err)
+	}
+	if status := readyz(); status.Status != "ok" {
+		t.Fatalf("Expected readiness success: %+v", status)
+	}
+
+	// upload directory gone
+	cfg.UploadDirectory = filepath.Join(tmpDir, "nonexistent")
+	if status := readyz(); status.Status == "ok" {
+		t.Fatal("Expected readiness failure with missing upload directory")
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLanguage is used if neither the request nor the configuration
+// select a supported language.
+const defaultLanguage = "en"
+
+// languageCookie stores the language selected with the language switcher.
+const languageCookie = "lang"
+
+// languageNames are the supported languages as displayed in the language
+// switcher.
+var languageNames = map[string]string{
+	"en": "English",
+	"de": "Deutsch",
+}
+
+// messages is the message catalogue containing all page texts by language
+// and message key. Messages are format strings for fmt.Sprintf and may
+// contain markup; arguments are HTML escaped before formatting.
+var messages = map[string]map[string]string{
+	"en": {
+		"layout.title":              "%s Poster Submission",
+		"layout.conferencewebsite":  "Conference Website",
+		"layout.contact":            "Contact",
+		"layout.language":           "Language",
+		"form.intro":                "Please upload your PDF and video URL by <strong>%s</strong> using the form below. You have received an upload key in the instruction email.",
+		"form.reupload":             "You can access the form and re-upload your poster and URL until the deadline.",
+		"form.noemail":              "<strong>Please note: posters sent via email will not be considered.</strong>",
+		"form.videochannel":         "If you wish to have the pre-recorded video hosted on the %s you must upload your video <b>before %s</b>!",
+		"form.videochannel.name":    "%s video channel",
+		"form.videochannel.upload":  "Upload your video file here: %s.",
+		"form.videochannel.format":  "Preferred format is *.mp4.",
+		"form.videochannel.naming":  "File names <b>must</b> follow the naming scheme <code>AbstractNumber_FirstAuthor</code>.",
+		"form.videochannel.ignored": "<b>Other file names will not be considered</b> and authors cannot be informed.",
+		"form.title":                "%s Poster Submission Form",
+		"form.optional":             "Poster, video and video URL can be submitted independently. Parts you leave empty are kept from your previous submission.",
+		"form.poster":               "Poster (PDF)",
+		"form.poster.help":          "Poster or slides",
+		"form.video":                "Video",
+		"form.video.help":           "Short poster presentation video",
+		"form.video.formats":        "Accepted formats: %s",
+		"form.video.maxsize":        "At most %s MiB",
+		"form.video.maxduration":    "At most %s long",
+		"form.video.maxwidth":       "At most %s pixels wide",
+		"form.video.maxheight":      "At most %s pixels high",
+		"form.video.naming":         "The file name must follow the naming scheme <code>AbstractNumber_FirstAuthor</code>, e.g. <code>42_Smith.mp4</code>",
+		"form.videourl":             "Video URL",
+		"form.videourl.help":        "Link to short self-hosted presentation",
+		"form.passcode":             "Upload key",
+		"form.passcode.help":        "You have received an upload key in the instruction email",
+		"form.submit":               "Submit",
+		"form.closed":               "Poster and video submission is <b class=\"red\">closed</b>.",
+		"form.banner":               "Conference Logo",
+		"success.title":             "%s Poster Submission Success",
+		"success.successful":        "Your upload was <strong>successful!</strong>",
+		"success.preview":           "The following <strong>preview</strong> shows the information that will appear in the poster gallery alongside your poster.",
+		"success.review":            "Please review it carefully and <strong>%s</strong> if there are any issues.",
+		"contact.us":                "contact us",
+		"success.note":              "<b>NOTE: Please print this page or save the following for verification. You may be asked to produce the following key to verify your upload.</b>",
+		"success.verification":      "Poster upload verification:",
+		"success.session":           "Session %s",
+		"success.abstract":          "Abstract",
+		"success.posterpdf":         "Poster PDF",
+		"success.posterpdf.review":  "(click to review)",
+		"success.previewimage":      "Preview of the first poster page",
+		"success.mismatch":          "<strong>Please check your upload:</strong> the title and authors of your poster were not found in the uploaded PDF. If you uploaded the wrong file or used someone else's upload key, please upload the correct file or %s.",
+		"success.mismatch.title":    "Title of the uploaded PDF: %s",
+		"success.video":             "Poster presentation video",
+		"success.part.poster":       "Poster",
+		"success.part.video":        "Video",
+		"success.part.video_url":    "Video URL",
+		"success.updated":           "updated",
+		"success.kept":              "unchanged",
+		"success.nochange":          "no change detected, the upload is identical to the current file",
+		"failure.title":             "%s Poster Submission",
+		"failure.failed":            "The submission failed.",
+		"failure.contact":           "Please <strong>%s</strong> if there are any issues. <a href=\"/\">Click here</a> to return to the form and try again.",
+		"email.title":               "%s whitelist email address upload form",
+		"email.addresses":           "Email addresses",
+		"email.addresses.help":      "Email addresses can be separated by comma, semicolon, space, tab or newline. You can always upload a full list, only new addresses are added.",
+		"email.password":            "Password",
+		"email.received":            "Upload received",
+		"email.uploaded":            "Whitelist email addresses have been uploaded.",
+		"email.back":                "<a href=\"/uploademail\">Back to the email upload form</a>",
+		"email.failtitle":           "%s whitelist email upload",
+		"email.failed":              "The upload has failed.",
+		"email.retry":               "<a href=\"/uploademail\">Click here</a> to return to the upload form and try again.",
+		"error.internal":            "An internal error occurred.",
+		"error.contactadmin":        "Internal error: Please contact an administrator",
+		"error.emptypasscode":       "Empty passcode",
+		"error.passcode":            "Unauthorised: Incorrect passcode",
+		"error.password":            "Unauthorised: Incorrect password",
+		"error.posterupload":        "Poster upload failed",
+		"error.videoupload":         "Video upload failed",
+		"error.emptysubmission":     "Please select a poster, a video or enter a video URL",
+		"error.submissionclosed":    "Poster and video submission is closed. Your previous submission was not changed.",
+		"error.infected":            "The file %s was rejected because it contains malware. Your previous submission was not changed.",
+		"error.scanfailed":          "Uploaded files cannot be checked for malware at the moment. Please try again later.",
+		"error.scantoolarge":        "The uploaded file %s is too large to be checked for malware. Please upload a smaller file or contact us.",
+		"error.fileupload":          "File upload (%s) failed",
+		"error.videoinvalid":        "The uploaded video (%s) could not be read. Please upload a video file, e.g. MP4.",
+		"error.videotoolong":        "The uploaded video is %s long, but videos may be at most %s long.",
+		"error.videoformat":         "The uploaded video %s is not accepted. Please upload one of these formats: %s.",
+		"error.videocontainer":      "The uploaded video %s is actually a %s file, which is not accepted. Please upload one of these formats: %s.",
+		"error.videotoolarge":       "The uploaded video %s has %s MiB, but videos may be at most %s MiB.",
+		"error.videowidth":          "The uploaded video %s is %s pixels wide, but videos may be at most %s pixels wide.",
+		"error.videoheight":         "The uploaded video %s is %s pixels high, but videos may be at most %s pixels high.",
+		"error.videoname":           "The file name of the uploaded video %s does not follow the naming scheme AbstractNumber_FirstAuthor. Please rename it to %s.",
+		"error.storagefull":         "The storage for submissions is temporarily full. Your submission was not saved, please try again later.",
+		"error.posterquota":         "Your submission exceeds the storage limit of %s MiB per poster, including older versions. Please upload a smaller file or contact us.",
+		"error.formsubmission":      "Form submission failed",
+		"error.formdisplay":         "Form cannot be displayed",
+		"error.successrender":       "Submission success but error occurred. Please contact...",
+		"error.notfound":            "Submission not found",
+		"status.formtitle":          "%s: check your submission",
+		"status.intro":              "Enter your upload key to see your current submission and all older versions kept.",
+		"status.show":               "Show submission",
+		"status.title":              "%s: your submission",
+		"status.current":            "Current submission",
+		"status.uploaded":           "uploaded %s",
+		"status.none":               "not submitted",
+		"status.versions":           "Older versions",
+		"status.noversions":         "There are no older versions.",
+		"status.transcode":          "Video processing",
+		"status.transcode.queued":   "waiting to be converted to MP4",
+		"status.transcode.running":  "being converted to MP4",
+		"status.transcode.done":     "converted to MP4, the uploaded file is kept as an older version",
+		"status.transcode.failed":   "conversion to MP4 failed, the uploaded file is used unchanged",
+		"status.back":               "Back to the upload form",
+		"form.checkstatus":          "Check your current submission",
+		"status.actions":            "Change your submission",
+		"status.clearvideourl":      "Remove video URL",
+		"status.clearvideourl.help": "Remove the video URL from your submission. It is kept as an older version.",
+		"status.withdraw":           "Withdraw poster",
+		"status.withdraw.help":      "Withdraw your poster entirely. All uploaded files are removed from the gallery.",
+		"status.withdraw.confirm":   "I want to withdraw my poster",
+		"action.title":              "Submission changed",
+		"action.videourlcleared":    "Your video URL has been removed.",
+		"action.withdrawn":          "Your poster has been withdrawn.",
+		"error.confirmwithdraw":     "Please confirm that you want to withdraw your poster",
+		"checks.title":              "%s: PDF checks",
+		"checks.intro":              "Posters whose uploaded PDF likely belongs to another poster. Each PDF is checked when it is uploaded or restored.",
+		"checks.intro.all":          "Check results of all posters. Each PDF is checked when it is uploaded or restored.",
+		"checks.showall":            "Show all checked posters",
+		"checks.showmismatches":     "Show likely mismatches only",
+		"checks.none":               "No posters found.",
+		"checks.poster":             "Poster",
+		"checks.pdftitle":           "PDF title",
+		"checks.titlescore":         "Title words found",
+		"checks.authors":            "Authors found",
+		"checks.checked":            "Checked",
+		"checks.mismatch":           "likely mismatch",
+	},
+	"de": {
+		"layout.title":              "%s Postereinreichung",
+		"layout.conferencewebsite":  "Konferenz-Webseite",
+		"layout.contact":            "Kontakt",
+		"layout.language":           "Sprache",
+		"form.intro":                "Bitte laden Sie Ihr PDF und Ihre Video-URL bis <strong>%s</strong> über das folgende Formular hoch. Den Upload-Schlüssel haben Sie in der Anleitungs-E-Mail erhalten.",
+		"form.reupload":             "Sie können das Formular bis zum Ablauf der Frist erneut aufrufen und Poster und URL erneut hochladen.",
+		"form.noemail":              "<strong>Bitte beachten Sie: per E-Mail gesendete Poster werden nicht berücksichtigt.</strong>",
+		"form.videochannel":         "Wenn Ihr vorab aufgezeichnetes Video auf dem %s veröffentlicht werden soll, müssen Sie Ihr Video <b>vor %s</b> hochladen!",
+		"form.videochannel.name":    "Videokanal der %s",
+		"form.videochannel.upload":  "Laden Sie Ihre Videodatei hier hoch: %s.",
+		"form.videochannel.format":  "Bevorzugtes Format ist *.mp4.",
+		"form.videochannel.naming":  "Dateinamen <b>müssen</b> dem Schema <code>AbstractNumber_FirstAuthor</code> folgen.",
+		"form.videochannel.ignored": "<b>Andere Dateinamen werden nicht berücksichtigt</b> und die Autor*innen können nicht benachrichtigt werden.",
+		"form.title":                "%s Formular zur Postereinreichung",
+		"form.optional":             "Poster, Video und Video-URL können unabhängig voneinander eingereicht werden. Leer gelassene Teile bleiben aus Ihrer vorherigen Einreichung erhalten.",
+		"form.poster":               "Poster (PDF)",
+		"form.poster.help":          "Poster oder Folien",
+		"form.video":                "Video",
+		"form.video.help":           "Kurzes Video zur Posterpräsentation",
+		"form.video.formats":        "Akzeptierte Formate: %s",
+		"form.video.maxsize":        "Höchstens %s MiB",
+		"form.video.maxduration":    "Höchstens %s lang",
+		"form.video.maxwidth":       "Höchstens %s Pixel breit",
+		"form.video.maxheight":      "Höchstens %s Pixel hoch",
+		"form.video.naming":         "Der Dateiname muss dem Schema <code>AbstractNumber_FirstAuthor</code> folgen, z. B. <code>42_Smith.mp4</code>",
+		"form.videourl":             "Video-URL",
+		"form.videourl.help":        "Link zur selbst gehosteten Kurzpräsentation",
+		"form.passcode":             "Upload-Schlüssel",
+		"form.passcode.help":        "Den Upload-Schlüssel haben Sie in der Anleitungs-E-Mail erhalten",
+		"form.submit":               "Absenden",
+		"form.closed":               "Die Einreichung von Postern und Videos ist <b class=\"red\">geschlossen</b>.",
+		"form.banner":               "Konferenzlogo",
+		"success.title":             "%s Postereinreichung erfolgreich",
+		"success.successful":        "Ihr Upload war <strong>erfolgreich!</strong>",
+		"success.preview":           "Die folgende <strong>Vorschau</strong> zeigt die Informationen, die in der Postergalerie neben Ihrem Poster erscheinen.",
+		"success.review":            "Bitte prüfen Sie sie sorgfältig und <strong>%s</strong>, falls etwas nicht stimmt.",
+		"contact.us":                "kontaktieren Sie uns",
+		"success.note":              "<b>HINWEIS: Bitte drucken Sie diese Seite aus oder speichern Sie den folgenden Schlüssel. Sie werden möglicherweise gebeten, ihn zur Bestätigung Ihres Uploads vorzulegen.</b>",
+		"success.verification":      "Bestätigung des Poster-Uploads:",
+		"success.session":           "Session %s",
+		"success.abstract":          "Abstract",
+		"success.posterpdf":         "Poster-PDF",
+		"success.posterpdf.review":  "(zum Prüfen anklicken)",
+		"success.previewimage":      "Vorschau der ersten Posterseite",
+		"success.mismatch":          "<strong>Bitte prüfen Sie Ihren Upload:</strong> Titel und Autor*innen Ihres Posters wurden im hochgeladenen PDF nicht gefunden. Falls Sie die falsche Datei oder den Upload-Schlüssel einer anderen Person verwendet haben, laden Sie bitte die richtige Datei hoch oder %s.",
+		"success.mismatch.title":    "Titel des hochgeladenen PDFs: %s",
+		"success.video":             "Video zur Posterpräsentation",
+		"success.part.poster":       "Poster",
+		"success.part.video":        "Video",
+		"success.part.video_url":    "Video-URL",
+		"success.updated":           "aktualisiert",
+		"success.kept":              "unverändert",
+		"success.nochange":          "keine Änderung erkannt, der Upload ist identisch mit der aktuellen Datei",
+		"failure.title":             "%s Postereinreichung",
+		"failure.failed":            "Die Einreichung ist fehlgeschlagen.",
+		"failure.contact":           "Bitte <strong>%s</strong>, falls Probleme auftreten. <a href=\"/\">Hier klicken</a>, um zum Formular zurückzukehren und es erneut zu versuchen.",
+		"email.title":               "%s Formular für freigeschaltete E-Mail-Adressen",
+		"email.addresses":           "E-Mail-Adressen",
+		"email.addresses.help":      "E-Mail-Adressen können durch Komma, Semikolon, Leerzeichen, Tabulator oder Zeilenumbruch getrennt werden. Sie können jederzeit die vollständige Liste hochladen, nur neue Adressen werden hinzugefügt.",
+		"email.password":            "Passwort",
+		"email.received":            "Upload erhalten",
+		"email.uploaded":            "Die E-Mail-Adressen wurden hochgeladen.",
+		"email.back":                "<a href=\"/uploademail\">Zurück zum Formular für E-Mail-Adressen</a>",
+		"email.failtitle":           "%s Upload freigeschalteter E-Mail-Adressen",
+		"email.failed":              "Der Upload ist fehlgeschlagen.",
+		"email.retry":               "<a href=\"/uploademail\">Hier klicken</a>, um zum Formular zurückzukehren und es erneut zu versuchen.",
+		"error.internal":            "Ein interner Fehler ist aufgetreten.",
+		"error.contactadmin":        "Interner Fehler: Bitte wenden Sie sich an eine*n Administrator*in",
+		"error.emptypasscode":       "Leerer Upload-Schlüssel",
+		"error.passcode":            "Nicht autorisiert: Falscher Upload-Schlüssel",
+		"error.password":            "Nicht autorisiert: Falsches Passwort",
+		"error.posterupload":        "Poster-Upload fehlgeschlagen",
+		"error.videoupload":         "Video-Upload fehlgeschlagen",
+		"error.emptysubmission":     "Bitte wählen Sie ein Poster oder Video aus oder geben Sie eine Video-URL ein",
+		"error.submissionclosed":    "Die Einreichung von Postern und Videos ist geschlossen. Ihre bisherige Einreichung wurde nicht geändert.",
+		"error.infected":            "Die Datei %s wurde abgelehnt, da sie Schadsoftware enthält. Ihre bisherige Einreichung wurde nicht geändert.",
+		"error.scanfailed":          "Hochgeladene Dateien können derzeit nicht auf Schadsoftware geprüft werden. Bitte versuchen Sie es später erneut.",
+		"error.scantoolarge":        "Die hochgeladene Datei %s ist zu groß, um auf Schadsoftware geprüft zu werden. Bitte laden Sie eine kleinere Datei hoch oder kontaktieren Sie uns.",
+		"error.fileupload":          "Datei-Upload (%s) fehlgeschlagen",
+		"error.videoinvalid":        "Das hochgeladene Video (%s) konnte nicht gelesen werden. Bitte laden Sie eine Videodatei hoch, z. B. MP4.",
+		"error.videotoolong":        "Das hochgeladene Video ist %s lang, Videos dürfen aber höchstens %s lang sein.",
+		"error.videoformat":         "Das hochgeladene Video %s wird nicht akzeptiert. Bitte laden Sie eines dieser Formate hoch: %s.",
+		"error.videocontainer":      "Das hochgeladene Video %s ist tatsächlich eine %s-Datei, die nicht akzeptiert wird. Bitte laden Sie eines dieser Formate hoch: %s.",
+		"error.videotoolarge":       "Das hochgeladene Video %s hat %s MiB, Videos dürfen aber höchstens %s MiB groß sein.",
+		"error.videowidth":          "Das hochgeladene Video %s ist %s Pixel breit, Videos dürfen aber höchstens %s Pixel breit sein.",
+		"error.videoheight":         "Das hochgeladene Video %s ist %s Pixel hoch, Videos dürfen aber höchstens %s Pixel hoch sein.",
+		"error.videoname":           "Der Dateiname des hochgeladenen Videos %s folgt nicht dem Schema AbstractNumber_FirstAuthor. Bitte benennen Sie es in %s um.",
+		"error.storagefull":         "Der Speicher für Einreichungen ist vorübergehend voll. Ihre Einreichung wurde nicht gespeichert, bitte versuchen Sie es später noch einmal.",
+		"error.posterquota":         "Ihre Einreichung überschreitet die Speichergrenze von %s MiB pro Poster, einschließlich älterer Versionen. Bitte laden Sie eine kleinere Datei hoch oder kontaktieren Sie uns.",
+		"error.formsubmission":      "Absenden des Formulars fehlgeschlagen",
+		"error.formdisplay":         "Das Formular kann nicht angezeigt werden",
+		"error.successrender":       "Einreichung erfolgreich, aber es ist ein Fehler aufgetreten. Bitte kontaktieren Sie uns...",
+		"error.notfound":            "Einreichung nicht gefunden",
+		"status.formtitle":          "%s: Einreichung prüfen",
+		"status.intro":              "Geben Sie Ihren Upload-Schlüssel ein, um Ihre aktuelle Einreichung und alle aufbewahrten älteren Versionen anzuzeigen.",
+		"status.show":               "Einreichung anzeigen",
+		"status.title":              "%s: Ihre Einreichung",
+		"status.current":            "Aktuelle Einreichung",
+		"status.uploaded":           "hochgeladen %s",
+		"status.none":               "nicht eingereicht",
+		"status.versions":           "Ältere Versionen",
+		"status.noversions":         "Es gibt keine älteren Versionen.",
+		"status.transcode":          "Videoverarbeitung",
+		"status.transcode.queued":   "wartet auf die Umwandlung in MP4",
+		"status.transcode.running":  "wird in MP4 umgewandelt",
+		"status.transcode.done":     "in MP4 umgewandelt, die hochgeladene Datei wird als ältere Version aufbewahrt",
+		"status.transcode.failed":   "Umwandlung in MP4 fehlgeschlagen, die hochgeladene Datei wird unverändert verwendet",
+		"status.back":               "Zurück zum Upload-Formular",
+		"form.checkstatus":          "Aktuelle Einreichung prüfen",
+		"status.actions":            "Einreichung ändern",
+		"status.clearvideourl":      "Video-URL entfernen",
+		"status.clearvideourl.help": "Entfernt die Video-URL aus Ihrer Einreichung. Sie wird als ältere Version aufbewahrt.",
+		"status.withdraw":           "Poster zurückziehen",
+		"status.withdraw.help":      "Ziehen Sie Ihr Poster vollständig zurück. Alle hochgeladenen Dateien werden aus der Galerie entfernt.",
+		"status.withdraw.confirm":   "Ich möchte mein Poster zurückziehen",
+		"action.title":              "Einreichung geändert",
+		"action.videourlcleared":    "Ihre Video-URL wurde entfernt.",
+		"action.withdrawn":          "Ihr Poster wurde zurückgezogen.",
+		"error.confirmwithdraw":     "Bitte bestätigen Sie, dass Sie Ihr Poster zurückziehen möchten",
+		"checks.title":              "%s: PDF-Prüfung",
+		"checks.intro":              "Poster, deren hochgeladenes PDF wahrscheinlich zu einem anderen Poster gehört. Jedes PDF wird beim Hochladen oder Wiederherstellen geprüft.",
+		"checks.intro.all":          "Prüfergebnisse aller Poster. Jedes PDF wird beim Hochladen oder Wiederherstellen geprüft.",
+		"checks.showall":            "Alle geprüften Poster anzeigen",
+		"checks.showmismatches":     "Nur wahrscheinlich falsche Uploads anzeigen",
+		"checks.none":               "Keine Poster gefunden.",
+		"checks.poster":             "Poster",
+		"checks.pdftitle":           "PDF-Titel",
+		"checks.titlescore":         "Gefundene Titelwörter",
+		"checks.authors":            "Gefundene Autor*innen",
+		"checks.checked":            "Geprüft",
+		"checks.mismatch":           "wahrscheinlich falsch",
+	},
+}
+
+// tr returns the message with the given key in the requested language,
+// falling back to English if the language or message does not exist. The
+// arguments are HTML escaped and formatted into the message, except for
+// template.HTML arguments such as links built with link. Unknown keys are
+// returned escaped so literal messages are displayed as they are.
+func tr(lang, key string, args ...interface{}) template.HTML {
+	msg, ok := messages[lang][key]
+	if !ok {
+		msg, ok = messages[defaultLanguage][key]
+	}
+	if !ok {
+		return template.HTML(html.EscapeString(key))
+	}
+	escaped := make([]interface{}, len(args))
+	for idx, arg := range args {
+		if safe, ok := arg.(template.HTML); ok {
+			escaped[idx] = string(safe)
+		} else {
+			escaped[idx] = html.EscapeString(fmt.Sprint(arg))
+		}
+	}
+	return template.HTML(fmt.Sprintf(msg, escaped...))
+}
+
+// linkSchemes are the URL schemes link creates links for.
+var linkSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// link returns a link to target with the given text for use as an argument
+// of tr. Text is escaped unless it is template.HTML. Targets other than
+// http, https or mailto URLs, e.g. javascript: URLs from a misconfigured
+// theme, are not linked and only the text is returned.
+func link(target string, text interface{}) template.HTML {
+	content, ok := text.(template.HTML)
+	if !ok {
+		content = template.HTML(html.EscapeString(fmt.Sprint(text)))
+	}
+	parsed, err := url.Parse(strings.TrimSpace(target))
+	if err != nil || !linkSchemes[strings.ToLower(parsed.Scheme)] {
+		return content
+	}
+	return template.HTML(`<a href="` + html.EscapeString(parsed.String()) + `">` + string(content) + `</a>`)
+}
+
+// linkName returns the name of a footer link in the requested language.
+func linkName(lang string, link FooterLink) string {
+	if name, ok := link.Names[lang]; ok {
+		return name
+	}
+	return link.Name
+}
+
+// languageTag holds a language of an Accept-Language header with its quality.
+type languageTag struct {
+	lang    string
+	quality float64
+}
+
+// parseAcceptLanguage returns the languages of an Accept-Language header
+// ordered by descending quality. Region subtags are removed.
+func parseAcceptLanguage(header string) []string {
+	tags := make([]languageTag, 0)
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ";")
+		lang := strings.ToLower(strings.TrimSpace(parts[0]))
+		if lang == "" {
+			continue
+		}
+		lang = strings.SplitN(lang, "-", 2)[0]
+		quality := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		tags = append(tags, languageTag{lang: lang, quality: quality})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+	langs := make([]string, len(tags))
+	for idx, tag := range tags {
+		langs[idx] = tag.lang
+	}
+	return langs
+}
+
+// requestLanguage determines the page language of a request. A language
+// selected with the "lang" query parameter is stored in a cookie and takes
+// precedence over the cookie, which in turn takes precedence over the
+// Accept-Language header.
+func requestLanguage(w http.ResponseWriter, r *http.Request, fallback string) string {
+	if r == nil {
+		return fallback
+	}
+	if lang := r.URL.Query().Get("lang"); messages[lang] != nil {
+		if w != nil {
+			http.SetCookie(w, &http.Cookie{
+				Name:     languageCookie,
+				Value:    lang,
+				Path:     "/",
+				Expires:  time.Now().AddDate(1, 0, 0),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		return lang
+	}
+	if cookie, err := r.Cookie(languageCookie); err == nil && messages[cookie.Value] != nil {
+		return cookie.Value
+	}
+	for _, lang := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if messages[lang] != nil {
+			return lang
+		}
+	}
+	return fallback
+}
+
+// languageLink is an entry of the language switcher.
+type languageLink struct {
+	Lang   string
+	Name   string
+	URL    string
+	Active bool
+}
+
+// languageLinks returns the language switcher entries for a request. The
+// links point to the current page for GET requests and to the form
+// otherwise, since result pages cannot be requested again.
+func languageLinks(r *http.Request, current string) []languageLink {
+	path := "/"
+	if r != nil && r.Method == http.MethodGet {
+		path = r.URL.Path
+	}
+	langs := make([]string, 0, len(languageNames))
+	for lang := range languageNames {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	links := make([]languageLink, len(langs))
+	for idx, lang := range langs {
+		links[idx] = languageLink{
+			Lang:   lang,
+			Name:   languageNames[lang],
+			URL:    path + "?lang=" + lang,
+			Active: lang == current,
+		}
+	}
+	return links
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCatalogueComplete(t *testing.T) {
+	for lang, catalogue := range messages {
+		for key := range messages[defaultLanguage] {
+			if _, ok := catalogue[key]; !ok {
+				t.Errorf("Message %q missing in language %q", key, lang)
+			}
+		}
+		if _, ok := languageNames[lang]; !ok {
+			t.Errorf("Language %q has no display name", lang)
+		}
+	}
+}
+
+func TestTr(t *testing.T) {
+	if msg := tr("de", "error.fileupload", ".pdf"); msg != "Datei-Upload (.pdf) fehlgeschlagen" {
+		t.Fatalf("Unexpected translation: %q", msg)
+	}
+	// unsupported languages fall back to English
+	if msg := tr("fr", "error.fileupload", ".pdf"); msg != "File upload (.pdf) failed" {
+		t.Fatalf("Unexpected fallback translation: %q", msg)
+	}
+	// arguments and unknown keys are escaped
+	if msg := tr("en", "error.fileupload", "<b>"); msg != "File upload (&lt;b&gt;) failed" {
+		t.Fatalf("Unescaped argument: %q", msg)
+	}
+	if msg := tr("en", "<b>literal</b>"); msg != "&lt;b&gt;literal&lt;/b&gt;" {
+		t.Fatalf("Unescaped unknown key: %q", msg)
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	langs := parseAcceptLanguage("fr-CH, fr;q=0.9, en;q=0.8, de-DE;q=0.95, *;q=0.5")
+	expected := []string{"fr", "de", "fr", "en", "*"}
+	if !reflect.DeepEqual(langs, expected) {
+		t.Fatalf("Unexpected languages: %v", langs)
+	}
+	if langs := parseAcceptLanguage(""); len(langs) != 0 {
+		t.Fatalf("Unexpected languages for empty header: %v", langs)
+	}
+}
+
+func TestRequestLanguage(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if lang := requestLanguage(nil, req, "en"); lang != "en" {
+		t.Fatalf("Unexpected default language: %q", lang)
+	}
+
+	req.Header.Set("Accept-Language", "fr, de-AT;q=0.8, en;q=0.5")
+	if lang := requestLanguage(nil, req, "en"); lang != "de" {
+		t.Fatalf("Unexpected Accept-Language result: %q", lang)
+	}
+
+	// the cookie takes precedence over the header
+	req.AddCookie(&http.Cookie{Name: languageCookie, Value: "en"})
+	if lang := requestLanguage(nil, req, "en"); lang != "en" {
+		t.Fatalf("Unexpected cookie result: %q", lang)
+	}
+
+	// the query parameter takes precedence and is stored in a cookie
+	req = httptest.NewRequest("GET", "/?lang=de", nil)
+	req.AddCookie(&http.Cookie{Name: languageCookie, Value: "en"})
+	w := httptest.NewRecorder()
+	if lang := requestLanguage(w, req, "en"); lang != "de" {
+		t.Fatalf("Unexpected query parameter result: %q", lang)
+	}
+	if cookie := w.Result().Cookies(); len(cookie) != 1 || cookie[0].Value != "de" {
+		t.Fatalf("Language cookie not set: %v", cookie)
+	}
+}
+
+func TestFailureTranslated(t *testing.T) {
+	cfg := defaultConfig()
+	req := httptest.NewRequest("POST", "/submit", nil)
+	req.Header.Set("Accept-Language", "de")
+	w := httptest.NewRecorder()
+	builtinTemplates.failure(w, http.StatusUnauthorized, cfg.templateData(w, req), "error.passcode")
+	res := w.Body.String()
+	for _, item := range []string{"Nicht autorisiert: Falscher Upload-Schlüssel", "Impressum", `lang="de"`, `href="/?lang=en"`} {
+		if !strings.Contains(res, item) {
+			t.Fatalf("Failure page is missing %q", item)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	if l := link("https://example.org/?a=1&b=2", "<Channel>"); l != `<a href="https://example.org/?a=1&amp;b=2">&lt;Channel&gt;</a>` {
+		t.Fatalf("Unexpected link: %q", l)
+	}
+	if l := link("mailto:support@example.org", tr("de", "contact.us")); l != `<a href="mailto:support@example.org">kontaktieren Sie uns</a>` {
+		t.Fatalf("Unexpected mailto link: %q", l)
+	}
+	// other schemes are not linked, only the text is shown
+	for _, target := range []string{"javascript:alert(1)", " JavaScript:alert(1)", "data:text/html,x", "%zz"} {
+		if l := link(target, "text"); l != "text" {
+			t.Errorf("Unexpected link for %q: %q", target, l)
+		}
+	}
+	// links are formatted into messages unescaped, other arguments escaped
+	msg := tr("en", "form.videochannel.upload", link(`https://example.org/"x`, `"x`))
+	if msg != `Upload your video file here: <a href="https://example.org/%22x">&#34;x</a>.` {
+		t.Fatalf("Unexpected message: %q", msg)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Storage layouts
+const (
+	// layoutFlat stores all files in one directory as <ID>.pdf, <ID>-v1.pdf
+	layoutFlat = "flat"
+	// layoutDirectories stores the files of each poster in <ID>/current/
+	// and older versions in <ID>/versions/<version>/
+	layoutDirectories = "directories"
+)
+
+// Directories of the directories layout.
+const (
+	currentDir  = "current"
+	versionsDir = "versions"
+)
+
+// storedNameRe splits the names of stored files into poster ID, version
+// and the remaining suffix including the extension. Versions are named
+// after their upload time and hash, or numbered in older uploads.
+var storedNameRe = regexp.MustCompile(`^([^/]+?)(?:-v([0-9]+|[0-9]{8}T[0-9]{6}Z(?:-[0-9a-f]+)?))?((?:-thumb|-preview|-meta|-README|-check)?\.[^./]+)$`)
+
+// versionLikeRe matches poster IDs which could be mistaken for versions.
+var versionLikeRe = regexp.MustCompile(`-v[0-9]`)
+
+// validPosterID returns false for poster IDs whose stored files would be
+// misparsed, e.g. "a-v1" or "a-thumb", or which are path names or hidden
+// files. The files of a valid ID always parse back to the ID.
+func validPosterID(id string) bool {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, "/\\") || versionLikeRe.MatchString(id) {
+		return false
+	}
+	thumbName, _ := previewNames(id)
+	for _, name := range []string{id + ".pdf", thumbName} {
+		parsed, current, version, ok := parseStoredName(name)
+		if !ok || parsed != id || current != name || version != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseStoredName returns the poster ID, the name of the current file and
+// the version of a stored file name, e.g. "id", "id.pdf",
+// "20221019T095249Z-aad40d63" for "id-v20221019T095249Z-aad40d63.pdf".
+// The version is empty for current files and ok is false for names not
+// belonging to a poster.
+func parseStoredName(name string) (id, current, version string, ok bool) {
+	submatch := storedNameRe.FindStringSubmatch(name)
+	if submatch == nil {
+		return "", "", "", false
+	}
+	return submatch[1], submatch[1] + submatch[3], submatch[2], true
+}
+
+// versionName returns the name of an older version of a current file.
+func versionName(id, current, version string) string {
+	return id + "-v" + version + strings.TrimPrefix(current, id)
+}
+
+// isVersion returns true if name is an older version of a file.
+func isVersion(name string) bool {
+	_, _, version, _ := parseStoredName(name)
+	return version != ""
+}
+
+// withLayout returns a storage storing files of the backend in the
+// provided layout. The flat layout stores files under their names.
+func withLayout(layout string, backend storage) storage {
+	if layout != layoutDirectories {
+		return backend
+	}
+	dirs := posterDirs{backend: backend}
+	if local, ok := backend.(localStorage); ok {
+		return localPosterDirs{posterDirs: dirs, local: local}
+	}
+	return dirs
+}
+
+// posterDirs stores files in the directories layout. It accepts the same
+// names as the flat layout and maps them to paths in the backend, so the
+// rest of the uploader does not depend on the layout.
+type posterDirs struct {
+	backend storage
+}
+
+// path returns the backend path of a file. Names not belonging to a
+// poster are stored unchanged.
+func (pd posterDirs) path(name string) string {
+	id, current, version, ok := parseStoredName(name)
+	if !ok {
+		return name
+	}
+	if version == "" {
+		return id + "/" + currentDir + "/" + current
+	}
+	return id + "/" + versionsDir + "/" + version + "/" + current
+}
+
+func (pd posterDirs) Save(name string, content io.ReadSeeker) error {
+	return pd.backend.Save(pd.path(name), content)
+}
+
+func (pd posterDirs) Rename(from, to string) error {
+	return pd.backend.Rename(pd.path(from), pd.path(to))
+}
+
+// idPrefix returns the prefix of the IDs of all posters which may have
+// files starting with prefix; the ID ends at the first dot or dash at the
+// latest.
+func idPrefix(prefix string) string {
+	if idx := strings.IndexAny(prefix, ".-"); idx >= 0 {
+		return prefix[:idx]
+	}
+	return prefix
+}
+
+// name maps a backend path to the file name or returns false for paths
+// not written by posterDirs.
+func (pd posterDirs) name(path string) (string, bool) {
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 1:
+		return path, true
+	case len(parts) == 3 && parts[1] == currentDir:
+		return parts[2], true
+	case len(parts) == 4 && parts[1] == versionsDir:
+		return versionName(parts[0], parts[3], parts[2]), true
+	}
+	return "", false
+}
+
+// List maps the backend paths of all posters with IDs which may start with
+// prefix to file names and returns the names starting with prefix.
+func (pd posterDirs) List(prefix string) ([]string, error) {
+	paths, err := pd.backend.List(idPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, path := range paths {
+		if name, ok := pd.name(path); ok && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (pd posterDirs) ListSizes(prefix string) (map[string]int64, error) {
+	pathSizes, err := listSizes(pd.backend, idPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(pathSizes))
+	for path, size := range pathSizes {
+		if name, ok := pd.name(path); ok && strings.HasPrefix(name, prefix) {
+			sizes[name] = size
+		}
+	}
+	return sizes, nil
+}
+
+func (pd posterDirs) Stat(name string) (*storedFile, error) {
+	stored, err := pd.backend.Stat(pd.path(name))
+	if err != nil {
+		return nil, err
+	}
+	stored.Name = name
+	return stored, nil
+}
+
+func (pd posterDirs) Open(name string) (readSeekCloser, error) {
+	return pd.backend.Open(pd.path(name))
+}
+
+func (pd posterDirs) Delete(name string) error {
+	return pd.backend.Delete(pd.path(name))
+}
+
+// localPosterDirs is the directories layout on a local backend.
+type localPosterDirs struct {
+	posterDirs
+	local localStorage
+}
+
+func (lpd localPosterDirs) LocalPath(name string) string {
+	return lpd.local.LocalPath(lpd.path(name))
+}
+
+func (lpd localPosterDirs) LocalRoot() string {
+	return lpd.local.LocalRoot()
+}
+
+// migrateLayout moves all files of the backend to the provided layout and
+// returns the number of files moved. Files already in the target layout
+// are not changed.
+func migrateLayout(backend storage, layout string) (int, error) {
+	switch layout {
+	case layoutDirectories:
+		return migrateToDirectories(backend)
+	case layoutFlat:
+		return migrateToFlat(backend)
+	default:
+		return 0, fmt.Errorf("unsupported storage layout %q (%s, %s)", layout, layoutFlat, layoutDirectories)
+	}
+}
+
+// migrateToDirectories moves flat files to the directories layout.
+func migrateToDirectories(backend storage) (int, error) {
+	names, err := backend.List("")
+	if err != nil {
+		return 0, err
+	}
+	dirs := posterDirs{backend: backend}
+	moved := 0
+	for _, name := range names {
+		if strings.Contains(name, "/") {
+			continue
+		} else if _, _, _, ok := parseStoredName(name); !ok {
+			log.Printf("Skipping %s: not a poster file", name)
+			continue
+		}
+		if err := backend.Rename(name, dirs.path(name)); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// migrateToFlat moves files in the directories layout to the flat layout.
+func migrateToFlat(backend storage) (int, error) {
+	dirs := posterDirs{backend: backend}
+	names, err := dirs.List("")
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for _, name := range names {
+		path := dirs.path(name)
+		if path == name {
+			continue
+		}
+		if err := backend.Rename(path, name); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
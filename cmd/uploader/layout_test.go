@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseStoredName(t *testing.T) {
+	type parsed struct {
+		id, current, version string
+	}
+	for name, expected := range map[string]parsed{
+		"id.pdf":                            {"id", "id.pdf", ""},
+		"id-v2.pdf":                         {"id", "id.pdf", "2"},
+		"id-v20221019T095249Z-aad40d63.pdf": {"id", "id.pdf", "20221019T095249Z-aad40d63"},
+		"id-v20221019T095249Z.url":          {"id", "id.url", "20221019T095249Z"},
+		"id-thumb.png":                      {"id", "id-thumb.png", ""},
+		"id-meta.json":                      {"id", "id-meta.json", ""},
+		"id-README.md":                      {"id", "id-README.md", ""},
+		"A-12.url":                          {"A-12", "A-12.url", ""},
+		"A-12-v10.url":                      {"A-12", "A-12.url", "10"},
+		"A-v2-x.pdf":                        {"A-v2-x", "A-v2-x.pdf", ""},
+		"id/current/x.pdf":                  {},
+		"README":                            {},
+	} {
+		id, current, version, _ := parseStoredName(name)
+		if (parsed{id, current, version}) != expected {
+			t.Errorf("Unexpected result for %q: %q %q %q", name, id, current, version)
+		}
+	}
+}
+
+func TestDirectoriesLayout(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.StorageLayout = layoutDirectories
+	cfg.KeepVersions = 3
+
+	for _, content := range []string{"%PDF-1.4 first", "%PDF-1.4 second", "%PDF-1.4 third"} {
+		files := map[string][2]string{"poster": {"poster.pdf", content}}
+		req := newSubmissionRequest(t, "/api/v1/submissions", map[string]string{"video_url": "https://example.com/" + content[9:]}, files)
+		req.Header.Set(uploadKeyHeader, "key")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Unexpected status code %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// only the poster directory is in the upload directory
+	if err := checkDirFiles(cfg.UploadDirectory, 1); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, "id", "current", "id.pdf")); err != nil || string(data) != "%PDF-1.4 third" {
+		t.Fatalf("Unexpected current poster %q: %v", data, err)
+	}
+	versionDirs, err := ioutil.ReadDir(filepath.Join(cfg.UploadDirectory, "id", "versions"))
+	// each version of the poster and the URL has its own directory
+	if err != nil || len(versionDirs) != 4 {
+		t.Fatalf("Expected four version directories: %v", err)
+	}
+
+	versions, err := listVersions(newStorage(cfg), "id.pdf")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("Unexpected versions %+v: %v", versions, err)
+	}
+	if !strings.HasPrefix(versions[0].Name, "id-v") || !strings.HasSuffix(versions[0].Version, sha1String("%PDF-1.4 second")[:8]) || !strings.HasSuffix(versions[1].Version, sha1String("%PDF-1.4 first")[:8]) {
+		t.Fatalf("Unexpected versions %+v, %+v", versions[0].storedFile, versions[1].storedFile)
+	}
+
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", versions[0].URL(), nil))
+	if w.Code != http.StatusOK || w.Body.String() != "%PDF-1.4 second" {
+		t.Fatalf("Unexpected upload response %d: %q", w.Code, w.Body.String())
+	}
+
+	// withdrawal moves all files and removes the poster directory
+	moved, err := withdrawPoster(cfg, "id", actorPresenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// poster, two poster versions, check result, video URL, two URL
+	// versions and metadata
+	if len(moved) != 8 {
+		t.Fatalf("Unexpected withdrawn files %v", moved)
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLayout(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	backend := newBackend(cfg)
+
+	// numbered versions of older uploads are migrated as well
+	flat := []string{"id-thumb.png", "id-v1.pdf", "id-v20221019T095249Z-aad40d63.pdf", "id.pdf", "id.url", "other.pdf"}
+	for _, name := range append(flat, "README") {
+		if err := backend.Save(name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved, err := migrateLayout(backend, layoutDirectories)
+	if err != nil || moved != len(flat) {
+		t.Fatalf("Unexpected migration result %d: %v", moved, err)
+	}
+	dirs := withLayout(layoutDirectories, backend)
+	names, err := dirs.List("")
+	if err != nil || strings.Join(names, " ") != "README "+strings.Join(flat, " ") {
+		t.Fatalf("Unexpected files after migration %v: %v", names, err)
+	}
+	for _, name := range flat {
+		if data, err := readStored(dirs, name); err != nil || data != name {
+			t.Fatalf("Unexpected content of %s after migration %q: %v", name, data, err)
+		}
+	}
+	for _, path := range []string{"other/current/other.pdf", "id/versions/20221019T095249Z-aad40d63/id.pdf"} {
+		if _, err := os.Stat(filepath.Join(cfg.UploadDirectory, filepath.FromSlash(path))); err != nil {
+			t.Fatalf("Unexpected path after migration: %v", err)
+		}
+	}
+
+	// and back
+	moved, err = migrateLayout(backend, layoutFlat)
+	if err != nil || moved != len(flat) {
+		t.Fatalf("Unexpected migration result %d: %v", moved, err)
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, len(flat)+1); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range flat {
+		if data, err := readStored(backend, name); err != nil || data != name {
+			t.Fatalf("Unexpected content of %s after migration %q: %v", name, data, err)
+		}
+	}
+}
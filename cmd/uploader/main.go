@@ -5,18 +5,20 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
+	"expvar"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/G-Node/tonic/tonic/web"
@@ -40,22 +42,95 @@ func init() {
 
 // Uploader is the main service struct.
 type Uploader struct {
-	Config *Config
-	Web    *web.Server
+	Web   *web.Server
+	certs *certReloader
+	// config holds the current *Config and is replaced on reload
+	config atomic.Value
+	// templates are the page templates of the configured theme
+	templates templateSet
+	// configFile and configRequired are used to reload the configuration
+	configFile     string
+	configRequired bool
+	// publisher commits submissions to the gallery repository; nil if
+	// publishing is disabled
+	publisher *publisher
+	// renderer renders poster previews instead of PreviewCommand if set
+	renderer previewRenderer
+	// extractor extracts the text of posters instead of PDFTextCommand if
+	// set
+	extractor textExtractor
+	// prober probes uploaded videos instead of VideoProbeCommand if set
+	prober videoProber
+	// transcoder converts uploaded videos to the standard MP4 profile; nil
+	// if transcoding is disabled
+	transcoder *transcodeQueue
+	// rechecking is 1 while the PDFs of all posters are checked again in
+	// rechecks
+	rechecking int32
+	rechecks   sync.WaitGroup
+}
+
+// Config returns the currently active configuration. Handlers should call
+// it once per request to work on a consistent configuration.
+func (uploader *Uploader) Config() *Config {
+	return uploader.config.Load().(*Config)
 }
 
 // NewUploader creates and initializes the Uploader server.
 func NewUploader(cfg *Config) *Uploader {
 	uploader := new(Uploader)
-	uploader.Config = cfg
-	// TODO: Use configured port when tonic.Web supports it
+	uploader.config.Store(cfg)
+	if set, err := loadTemplates(cfg.ThemeDirectory); err != nil {
+		log.Printf("Error loading theme from %q; using built-in templates: %v", cfg.ThemeDirectory, err)
+		uploader.templates = builtinTemplates
+	} else {
+		uploader.templates = set
+	}
+	if cfg.GalleryRepository != "" {
+		pub, err := newPublisher(uploader.Config, uploader.templates.readme)
+		if err != nil {
+			log.Printf("ERROR loading publish queue; publishing is disabled: %v", err)
+		} else {
+			uploader.publisher = pub
+		}
+	}
+	if cfg.TranscodeCommand != "" {
+		tq, err := newTranscodeQueue(uploader.Config, uploader.templates.readme)
+		if err != nil {
+			log.Printf("ERROR loading transcode queue; transcoding is disabled: %v", err)
+		} else {
+			tq.done = uploader.publish
+			uploader.transcoder = tq
+		}
+	}
+
 	srv := web.New()
+	srv.Server.Addr = listenAddress(cfg)
 	srv.Router.HandleFunc("/", uploader.renderForm).Methods("GET")
 	srv.Router.HandleFunc("/submit", uploader.submit).Methods("POST")
 	srv.Router.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", http.FileServer(http.Dir("./assets"))))
-	srv.Router.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir(cfg.UploadDirectory))))
+	srv.Router.PathPrefix("/uploads/").HandlerFunc(uploader.serveUpload).Methods("GET", "HEAD")
 	srv.Router.HandleFunc("/uploademail", uploader.uploademail).Methods("GET")
 	srv.Router.HandleFunc("/submitemail", uploader.submitemail).Methods("POST")
+	srv.Router.HandleFunc("/status", uploader.statusForm).Methods("GET")
+	srv.Router.HandleFunc("/status", uploader.status).Methods("POST")
+	srv.Router.HandleFunc("/status/clearvideourl", uploader.statusClearVideoURL).Methods("POST")
+	srv.Router.HandleFunc("/status/withdraw", uploader.statusWithdraw).Methods("POST")
+	srv.Router.HandleFunc("/api/v1/submissions", uploader.apiSubmit).Methods("POST")
+	srv.Router.HandleFunc("/api/v1/submissions/{id}", uploader.apiSubmission).Methods("GET")
+	srv.Router.HandleFunc("/healthz", uploader.healthz).Methods("GET")
+	srv.Router.HandleFunc("/readyz", uploader.readyz).Methods("GET")
+	srv.Router.HandleFunc("/admin/config", uploader.requireAdmin(uploader.adminConfig)).Methods("GET")
+	srv.Router.HandleFunc("/admin/reload", uploader.requireAdmin(uploader.adminReload)).Methods("POST")
+	srv.Router.HandleFunc("/admin/posters/checks", uploader.requireAdmin(uploader.adminPosterChecks)).Methods("GET")
+	srv.Router.HandleFunc("/admin/posters/checks", uploader.requireAdmin(uploader.adminRecheckPosters)).Methods("POST")
+	srv.Router.HandleFunc("/admin/posters/{id}/clearvideourl", uploader.requireAdmin(uploader.adminClearVideoURL)).Methods("POST")
+	srv.Router.HandleFunc("/admin/posters/{id}/withdraw", uploader.requireAdmin(uploader.adminWithdraw)).Methods("POST")
+	srv.Router.HandleFunc("/admin/posters/{id}/restore", uploader.requireAdmin(uploader.adminRestore)).Methods("POST")
+	srv.Router.HandleFunc("/admin/posters/{id}/publish", uploader.requireAdmin(uploader.adminPublish)).Methods("POST")
+	srv.Router.HandleFunc("/admin/publish", uploader.requireAdmin(uploader.adminPublishStatus)).Methods("GET")
+	srv.Router.HandleFunc("/admin/storage", uploader.requireAdmin(uploader.adminStorage)).Methods("GET")
+	srv.Router.HandleFunc("/admin/metrics", uploader.requireAdmin(expvar.Handler().ServeHTTP)).Methods("GET")
 	uploader.Web = srv
 
 	// Increase timeouts
@@ -68,15 +143,37 @@ func NewUploader(cfg *Config) *Uploader {
 func main() {
 	log.Print(verstr)
 	help := flag.Bool("help", false, "help")
+	writeThemeFlag := flag.String("write-theme", "", "write the built-in templates to the specified directory as a starting point for a custom theme")
 	writeConfigFlag := flag.Bool("write-config", false, "write default configuration to file (use --config to specify file location)")
+	checkConfigFlag := flag.Bool("check-config", false, "validate the configuration and exit")
+	migrateLayoutFlag := flag.String("migrate-layout", "", "move stored files to the specified storage layout (flat, directories) and exit; the server must not be running")
+	importPostersFlag := flag.String("import-posters", "", "validate a CSV or JSON posters export, write it to postersinfofile and exit; the file is not written if problems such as duplicate IDs, upload keys or abstract numbers are found")
+	pruneVersionsFlag := flag.Bool("prune-versions", false, "delete older file versions exceeding keepversions and keepversionsdays and exit")
 	configFile := flag.String("config", "config", "config file")
 	flag.Parse()
 
+	// the config file may be omitted if it was not explicitly specified;
+	// defaults and UPLOADER_* environment variables are used instead
+	configRequired := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			configRequired = true
+		}
+	})
+
 	if *help {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if *writeThemeFlag != "" {
+		if err := writeTheme(*writeThemeFlag); err != nil {
+			fmt.Printf("Error writing theme: %s\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	if *writeConfigFlag {
 		if _, err := os.Stat(*configFile); err == nil {
 		PROMPT:
@@ -105,220 +202,174 @@ func main() {
 		os.Exit(0)
 	}
 
-	log.Printf("Loading configuration from %q", *configFile)
-	config := readConfig(*configFile)
-	log.Printf("%+v", config)
-	uploader := NewUploader(config)
-	uploader.Web.Start()
-	log.Printf("Listening on port %d", config.Port)
-	sigchan := make(chan os.Signal, 1)
-	signal.Notify(sigchan, os.Interrupt)
-	<-sigchan
-	uploader.Web.Stop()
-}
-
-func (uploader *Uploader) renderForm(w http.ResponseWriter, r *http.Request) {
-	baseTemplateData := map[string]interface{}{
-		"supportemail":      uploader.Config.SupportEmail,
-		"conferencepageurl": uploader.Config.ConferencePageURL,
+	if *checkConfigFlag {
+		os.Exit(checkConfig(*configFile, configRequired))
 	}
 
-	tmpl, err := PrepareTemplate(Form)
-	if err != nil {
-		failure(w, http.StatusInternalServerError, baseTemplateData, "Internal error: Please contact an administrator")
-		return
+	if *migrateLayoutFlag != "" {
+		os.Exit(migrateConfiguredStorage(*configFile, configRequired, *migrateLayoutFlag))
 	}
 
-	submission := true
-	if closedate, err := time.Parse("2006-01-02", uploader.Config.SubmissionClosedDate); err != nil {
-		log.Println("Could not parse submission closing date; submission is open")
-	} else {
-		submission = time.Now().Before(closedate)
+	if *pruneVersionsFlag {
+		os.Exit(pruneConfiguredStorage(*configFile, configRequired))
 	}
 
-	formOpts := map[string]interface{}{
-		"submission":        submission,
-		"videos":            uploader.Config.Videos,
-		"viduploadurl":      uploader.Config.VideoUploadURL,
-		"conferencepageurl": uploader.Config.ConferencePageURL,
-		"supportemail":      uploader.Config.SupportEmail,
-		"closedtext":        uploader.Config.SubmissionClosedText,
-		"closedtextvid":     uploader.Config.SubmissionClosedVideoText,
+	if *importPostersFlag != "" {
+		os.Exit(importConfiguredPosters(*configFile, configRequired, *importPostersFlag))
 	}
 
-	if err := tmpl.Execute(w, formOpts); err != nil {
-		log.Printf("Failed to render form: %v", err)
+	log.Printf("Loading configuration from %q", *configFile)
+	config := readConfig(*configFile, configRequired)
+	log.Printf("Configuration: %s", config)
+	log.Printf("Changed from defaults: %s", formatChanges(diffConfig(defaultConfig(), config)))
+	if config.WhitelistPW == defaultWhitelistPW {
+		log.Print("WARNING whitelistpw is not configured: the whitelist form uses a random password until it is set")
+	}
+	uploader := NewUploader(config)
+	uploader.configFile = *configFile
+	uploader.configRequired = configRequired
+	if err := uploader.Start(); err != nil {
+		log.Printf("Error starting server: %v", err)
+		os.Exit(1)
+	}
+	log.Printf("Listening %s", listenDescription(config))
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigchan {
+		if sig == syscall.SIGHUP {
+			uploader.reload()
+			continue
+		}
+		break
 	}
+	uploader.Web.Stop()
 }
 
-func renameExistingFiles(path string, nversions int) {
-	log.Printf("Checking for older versions of %s", path)
-	ext := filepath.Ext(path)
-	basename := strings.TrimSuffix(path, ext)
-
-	fileExists := func(fname string) bool {
-		if _, err := os.Stat(fname); err == nil {
-			return true
+// reload is called when the server receives a SIGHUP and reloads
+// resources that can change at runtime.
+func (uploader *Uploader) reload() {
+	// errors are logged and the current configuration is kept
+	_, _ = uploader.reloadAndLog()
+	if uploader.certs != nil {
+		if err := uploader.certs.Reload(); err != nil {
+			log.Printf("Error reloading TLS certificate: %v", err)
+		} else {
+			log.Print("TLS certificate reloaded")
 		}
-		return false
 	}
+}
 
-	nthFilename := func(n int) string {
-		return fmt.Sprintf("%s-v%d%s", basename, n, ext)
+// submissionOpen returns false once the submission closing date has been
+// reached. The submission stays open if the date cannot be parsed.
+func (cfg *Config) submissionOpen() bool {
+	closedate, err := time.Parse("2006-01-02", cfg.SubmissionClosedDate)
+	if err != nil {
+		log.Println("Could not parse submission closing date; submission is open")
+		return true
 	}
+	return time.Now().Before(closedate)
+}
 
-	// delete ver = nversions - 1 (oldest to keep) if it exists
-	oldestVer := nthFilename(nversions - 1)
-	if fileExists(oldestVer) {
-		log.Printf("Deleting old file %s", oldestVer)
-		err := os.Remove(oldestVer)
-		if err != nil {
-			log.Printf("Error removing file %s: %s", oldestVer, err.Error())
-		}
+func (uploader *Uploader) renderForm(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	baseTemplateData := cfg.templateData(w, r)
+
+	tmpl, err := uploader.templates.lookup(formPage)
+	if err != nil {
+		uploader.templates.failure(w, http.StatusInternalServerError, baseTemplateData, "error.contactadmin")
+		return
 	}
 
-	for n := nversions - 2; n > 0; n-- {
-		// for each one that exists, move it up one version
-		nthVer := nthFilename(n)
-		if fileExists(nthVer) {
-			nthPlusOne := nthFilename(n + 1)
-			log.Printf("Renaming old file %s -> %s", nthVer, nthPlusOne)
-			err := os.Rename(nthVer, nthPlusOne)
-			if err != nil {
-				log.Printf("Error renaming file %s: %s", nthVer, err.Error())
-			}
-		}
+	formOpts := cfg.templateData(w, r)
+	formOpts["submission"] = cfg.submissionOpen()
+	formOpts["videos"] = cfg.Videos
+	if policy := cfg.videoPolicy(); policy != (videoPolicy{}) {
+		formOpts["videopolicy"] = policy
 	}
+	formOpts["viduploadurl"] = cfg.VideoUploadURL
+	formOpts["closedtext"] = cfg.SubmissionClosedText
+	formOpts["closedtextvid"] = cfg.SubmissionClosedVideoText
 
-	// check for base file (no version suffix)
-	if fileExists(path) {
-		oneVer := nthFilename(1)
-		log.Printf("Renaming old file %s -> %s", path, oneVer)
-		err := os.Rename(path, oneVer)
-		if err != nil {
-			log.Printf("Error renaming file %s: %s", path, err.Error())
-		}
+	if err := tmpl.Execute(w, formOpts); err != nil {
+		log.Printf("Failed to render form: %v", err)
 	}
 }
 
 func (uploader *Uploader) submit(w http.ResponseWriter, r *http.Request) {
-	baseTemplateData := map[string]interface{}{
-		"supportemail":      uploader.Config.SupportEmail,
-		"conferencepageurl": uploader.Config.ConferencePageURL,
-	}
+	cfg := uploader.Config()
+	baseTemplateData := cfg.templateData(w, r)
 
 	log.Print("Submission received")
+	if serr := checkFreeSpace(cfg, r.ContentLength); serr != nil {
+		uploader.respondSubmissionError(w, r, baseTemplateData, serr)
+		return
+	}
 	err := r.ParseMultipartForm(1048576) // 1 MiB max mem
 	if err != nil {
 		// 500
 		log.Printf("Failed to parse form: %v", err.Error())
-		failure(w, http.StatusInternalServerError, baseTemplateData, "An internal error occurred.")
+		uploader.respondSubmissionError(w, r, baseTemplateData, newSubmissionError(http.StatusInternalServerError, "invalid_request", "error.internal"))
 		return
 	}
-	postValues := r.PostForm
 
-	passcode := postValues.Get("passcode")
-	if passcode == "" {
-		// 401
-		log.Printf("ERROR: empty passcode")
-		failure(w, http.StatusUnauthorized, baseTemplateData, "Empty passcode")
-		return
-	}
-	user, err := uploader.getUserInfo(passcode)
-	if err != nil {
-		// Check error message if unauthorised or server error and return appropriate response
-		log.Printf("ERROR: %v", err.Error())
-		failure(w, http.StatusUnauthorized, baseTemplateData, "Unauthorised: Incorrect passcode")
+	user, serr := uploader.authenticate(r.PostForm.Get("passcode"))
+	if serr != nil {
+		uploader.respondSubmissionError(w, r, baseTemplateData, serr)
 		return
 	}
 
-	log.Printf("User %q", user.Authors)
-
-	fileBasename := user.ID
-	err = os.MkdirAll(uploader.Config.UploadDirectory, 0777)
-	if err != nil {
-		log.Printf("ERROR handling upload directory: %v", err.Error())
-		failure(w, http.StatusInternalServerError, baseTemplateData, "Poster upload failed")
+	result, serr := uploader.saveSubmission(cfg, r, user)
+	if serr != nil {
+		uploader.respondSubmissionError(w, r, baseTemplateData, serr)
 		return
 	}
-	saveUploadedFile := func(file multipart.File, header *multipart.FileHeader) string {
-		ext := filepath.Ext(header.Filename)
-		fname := fmt.Sprintf("%s%s", fileBasename, ext)
-		log.Printf("Writing file %q", fname)
-		targetPath := filepath.Join(uploader.Config.UploadDirectory, fname)
-		renameExistingFiles(targetPath, uploader.Config.KeepVersions)
-		if err := saveFile(file, targetPath); err != nil {
-			log.Printf("ERROR: %v", err.Error())
-			failure(w, http.StatusInternalServerError, baseTemplateData, fmt.Sprintf("File upload (%s) failed", ext))
-			return ""
-		}
-		return targetPath
+	if len(result.Changed) > 0 {
+		uploader.publish(user.ID)
 	}
+	uploader.transcode(result)
 
-	// Save poster pdf
-	posterFile, posterHeader, err := r.FormFile("poster")
-	if err != nil {
-		log.Printf("ERROR: %v", err.Error())
-		failure(w, http.StatusInternalServerError, baseTemplateData, "Poster upload failed")
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, result)
 		return
 	}
-	posterPath := saveUploadedFile(posterFile, posterHeader)
-	posterHash, err := sha1File(posterPath)
-	if err != nil {
-		log.Printf("Failed to hash file upload %q: %s", posterPath, err.Error())
-	}
-	log.Printf("PDF file saved: %s (%s)", posterPath, posterHash)
-
-	if uploader.Config.Videos {
-		// Save video file
-		// account for the case that file upload is not required and the formfile can be empty.
-		// simply continue in this case.
-		videoFile, videoHeader, err := r.FormFile("video")
-		if err != nil && err != http.ErrMissingFile {
-			log.Printf("ERROR: %v", err.Error())
-			failure(w, http.StatusInternalServerError, baseTemplateData, "Video upload failed")
-			return
-		} else if err == http.ErrMissingFile {
-			log.Print("No video provided")
-		} else {
-			videoPath := saveUploadedFile(videoFile, videoHeader)
-			log.Printf("Video file saved: %s", videoPath)
-		}
-	}
 
-	videoURL := r.PostForm.Get("video_url")
-	if videoURL != "" {
-		fname := fmt.Sprintf("%s.url", fileBasename)
-		urlTargetPath := filepath.Join(uploader.Config.UploadDirectory, fname)
-		renameExistingFiles(urlTargetPath, uploader.Config.KeepVersions)
-		urlfile, err := os.Create(urlTargetPath)
-		if err != nil {
-			log.Printf("ERROR: %v", err.Error())
-			failure(w, http.StatusInternalServerError, baseTemplateData, "Form submission failed")
-			return
-		}
-		defer urlfile.Close()
-		if _, err := urlfile.WriteString(videoURL); err != nil {
-			log.Printf("ERROR: %v", err.Error())
-			failure(w, http.StatusInternalServerError, baseTemplateData, "Form submission failed")
-			return
-		}
-		log.Printf("URL file saved: %s (%s)", fname, videoURL)
+	submittedData := cfg.templateData(w, r)
+	submittedData["UserData"] = user
+	submittedData["VideoURL"] = result.VideoURL
+	submittedData["Parts"] = result.Parts()
+	if result.Poster != nil {
+		submittedData["PDFPath"] = result.Poster.URL()
+		submittedData["PosterHash"] = result.Poster.SHA1
 	}
+	if result.Preview != nil {
+		submittedData["PreviewURL"] = result.Preview.URL()
+	}
+	if result.Check != nil && result.Check.Mismatch {
+		submittedData["PDFMismatch"] = result.Check
+	}
+	uploader.templates.success(w, submittedData)
+}
 
-	submittedData := map[string]interface{}{
-		"UserData":          user,
-		"PDFPath":           posterPath,
-		"VideoURL":          videoURL,
-		"PosterHash":        posterHash,
-		"supportemail":      uploader.Config.SupportEmail,
-		"conferencepageurl": uploader.Config.ConferencePageURL,
+// authenticate returns the poster matching the provided upload key.
+func (uploader *Uploader) authenticate(passcode string) (*BCPoster, *submissionError) {
+	if passcode == "" {
+		// 401
+		log.Printf("ERROR: empty passcode")
+		return nil, newSubmissionError(http.StatusUnauthorized, "missing_upload_key", "error.emptypasscode")
 	}
-	success(w, submittedData)
+	user, err := uploader.getUserInfo(passcode)
+	if err != nil {
+		// Check error message if unauthorised or server error and return appropriate response
+		log.Printf("ERROR: %v", err.Error())
+		return nil, newSubmissionError(http.StatusUnauthorized, "invalid_upload_key", "error.passcode")
+	}
+	log.Printf("User %q", user.Authors)
+	return user, nil
 }
 
 func (uploader *Uploader) getUserInfo(key string) (*BCPoster, error) {
-	users, err := loadUserList(uploader.Config.PostersInfoFile)
+	cfg := uploader.Config()
+	users, err := loadUserList(cfg.PostersInfoFile)
 	if err != nil {
 		log.Printf("ERROR: %v", err.Error())
 		return nil, err
@@ -333,15 +384,13 @@ func (uploader *Uploader) getUserInfo(key string) (*BCPoster, error) {
 }
 
 func (uploader *Uploader) uploademail(w http.ResponseWriter, r *http.Request) {
-	baseTemplateData := map[string]interface{}{
-		"supportemail":      uploader.Config.SupportEmail,
-		"conferencepageurl": uploader.Config.ConferencePageURL,
-	}
+	cfg := uploader.Config()
+	baseTemplateData := cfg.templateData(w, r)
 
-	tmpl, err := PrepareTemplate(EmailFormTmpl)
+	tmpl, err := uploader.templates.lookup(emailFormPage)
 	if err != nil {
 		log.Printf("Error rendering email form page: %v", err)
-		failure(w, http.StatusInternalServerError, baseTemplateData, "Form cannot be displayed")
+		uploader.templates.failure(w, http.StatusInternalServerError, baseTemplateData, "error.formdisplay")
 		return
 	}
 
@@ -349,27 +398,25 @@ func (uploader *Uploader) uploademail(w http.ResponseWriter, r *http.Request) {
 	err = tmpl.Execute(w, &baseTemplateData)
 	if err != nil {
 		log.Printf("Error rendering email form page: %v", err)
-		failure(w, http.StatusInternalServerError, baseTemplateData, "Form cannot be displayed")
+		uploader.templates.failure(w, http.StatusInternalServerError, baseTemplateData, "error.formdisplay")
 	}
 }
 
 func (uploader *Uploader) submitemail(w http.ResponseWriter, r *http.Request) {
-	var filename = uploader.Config.WhitelistFile
-	var password = uploader.Config.WhitelistPW
+	cfg := uploader.Config()
+	var filename = cfg.WhitelistFile
+	var password = cfg.WhitelistPW
 
 	content := r.FormValue("content")
 	pwd := r.FormValue("password")
 
 	// Prepare minimal template information
-	baseTemplateData := map[string]interface{}{
-		"supportemail":      uploader.Config.SupportEmail,
-		"conferencepageurl": uploader.Config.ConferencePageURL,
-	}
+	baseTemplateData := cfg.templateData(w, r)
 
 	// In case of an invalid password redirect back to the upload form
 	if pwd != password {
 		log.Print("ERROR Invalid password received")
-		failure(w, http.StatusUnauthorized, baseTemplateData, "Unauthorised: Incorrect password")
+		uploader.templates.failure(w, http.StatusUnauthorized, baseTemplateData, "error.password")
 		return
 	}
 	log.Print("INFO Received whitelist email form")
@@ -386,7 +433,7 @@ func (uploader *Uploader) submitemail(w http.ResponseWriter, r *http.Request) {
 		datafile, err := os.Open(filename)
 		if err != nil {
 			log.Printf("ERROR Could not open whitelist email file: '%v'", err.Error())
-			failure(w, http.StatusInternalServerError, baseTemplateData, "Form submission failed")
+			uploader.templates.failure(w, http.StatusInternalServerError, baseTemplateData, "error.formsubmission")
 			return
 		}
 		fileScanner := bufio.NewScanner(datafile)
@@ -416,7 +463,7 @@ func (uploader *Uploader) submitemail(w http.ResponseWriter, r *http.Request) {
 	outfile, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
 		log.Printf("ERROR Could not open outfile for writing: '%v'", err)
-		failure(w, http.StatusInternalServerError, baseTemplateData, "Form submission failed")
+		uploader.templates.failure(w, http.StatusInternalServerError, baseTemplateData, "error.formsubmission")
 		return
 	}
 	defer outfile.Close()
@@ -431,10 +478,10 @@ func (uploader *Uploader) submitemail(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	tmpl, err := PrepareTemplate(EmailSubmitTmpl)
+	tmpl, err := uploader.templates.lookup(emailSubmitPage)
 	if err != nil {
 		log.Printf("Error rendering email submission page: %v", err)
-		failure(w, http.StatusInternalServerError, baseTemplateData, "Form submission failed")
+		uploader.templates.failure(w, http.StatusInternalServerError, baseTemplateData, "error.formsubmission")
 		return
 	}
 
@@ -442,12 +489,12 @@ func (uploader *Uploader) submitemail(w http.ResponseWriter, r *http.Request) {
 	err = tmpl.Execute(w, &baseTemplateData)
 	if err != nil {
 		log.Printf("Error rendering email submission page: %v", err)
-		failure(w, http.StatusInternalServerError, baseTemplateData, "Form submission failed")
+		uploader.templates.failure(w, http.StatusInternalServerError, baseTemplateData, "error.formsubmission")
 	}
 	log.Printf("Saved email hashes to %q", filename)
 }
 
-func saveFile(file multipart.File, target string) error {
+func saveFile(file io.Reader, target string) error {
 	buf := make([]byte, 1024)
 	outfile, err := os.Create(target)
 	if err != nil {
@@ -494,17 +541,20 @@ func sha1File(path string) (string, error) {
 		return "", err
 	}
 	defer file.Close()
+	return sha1Reader(file)
+}
 
+// sha1Reader returns the hex encoded SHA1 hash of all content read from r.
+func sha1Reader(r io.Reader) (string, error) {
 	hasher := sha1.New()
 
-	if _, err := io.Copy(hasher, file); err != nil {
+	if _, err := io.Copy(hasher, r); err != nil {
 		return "", err
 	}
 
 	hash := hasher.Sum(nil)
 	encoded := hex.EncodeToString(hash[:])
 	return encoded, nil
-
 }
 
 // BCPoster represents a conference poster item
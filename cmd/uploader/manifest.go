@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// manifestMutex serialises writes to the manifest file.
+var manifestMutex sync.Mutex
+
+// Manifest actions
+const (
+	actionClearVideoURL = "clear_video_url"
+	actionWithdraw      = "withdraw"
+	actionRestore       = "restore"
+	actionTranscode     = "transcode"
+)
+
+// manifestEntry records an action changing the stored files of a poster.
+type manifestEntry struct {
+	Time   time.Time `json:"time"`
+	ID     string    `json:"id"`
+	Action string    `json:"action"`
+	// Actor is "presenter" or "admin:<user>"
+	Actor string   `json:"actor"`
+	Files []string `json:"files,omitempty"`
+}
+
+// appendManifest appends an entry to the manifest file, one JSON document
+// per line.
+func appendManifest(cfg *Config, entry manifestEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	manifestMutex.Lock()
+	defer manifestMutex.Unlock()
+	file, err := os.OpenFile(cfg.ManifestFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	texttemplate "text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Metadata file formats
+const (
+	metadataJSON = "json"
+	metadataYAML = "yaml"
+)
+
+// Suffixes of the metadata files stored next to the poster.
+const (
+	metadataSuffix = "-meta."
+	readmeSuffix   = "-README.md"
+)
+
+// posterMetadata describes a poster and its stored files for the gallery
+// importer. File names are relative to the metadata file.
+type posterMetadata struct {
+	ID             string    `json:"id" yaml:"id"`
+	Title          string    `json:"title" yaml:"title"`
+	Authors        string    `json:"authors" yaml:"authors"`
+	Session        string    `json:"session,omitempty" yaml:"session,omitempty"`
+	Topic          string    `json:"topic,omitempty" yaml:"topic,omitempty"`
+	AbstractNumber string    `json:"abstract_number,omitempty" yaml:"abstract_number,omitempty"`
+	Abstract       string    `json:"abstract,omitempty" yaml:"abstract,omitempty"`
+	Poster         string    `json:"poster,omitempty" yaml:"poster,omitempty"`
+	PosterSHA1     string    `json:"poster_sha1,omitempty" yaml:"poster_sha1,omitempty"`
+	Thumbnail      string    `json:"thumbnail,omitempty" yaml:"thumbnail,omitempty"`
+	Preview        string    `json:"preview,omitempty" yaml:"preview,omitempty"`
+	Video          string    `json:"video,omitempty" yaml:"video,omitempty"`
+	VideoURL       string    `json:"video_url,omitempty" yaml:"video_url,omitempty"`
+	Updated        time.Time `json:"updated" yaml:"updated"`
+}
+
+// metadataName returns the name of the metadata file of a poster in the
+// configured format.
+func metadataName(cfg *Config, id string) string {
+	return id + metadataSuffix + cfg.MetadataFormat
+}
+
+// metadataNames returns the names of the metadata files of a poster in
+// all formats.
+func metadataNames(id string) []string {
+	return []string{id + metadataSuffix + metadataJSON, id + metadataSuffix + metadataYAML, id + readmeSuffix}
+}
+
+// findPoster returns the poster with the provided ID from the posters
+// file.
+func findPoster(cfg *Config, id string) (*BCPoster, error) {
+	users, err := loadUserList(cfg.PostersInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("poster %q not found in %s", id, cfg.PostersInfoFile)
+}
+
+// newPosterMetadata combines the poster information with the currently
+// stored files.
+func newPosterMetadata(user *BCPoster, current *submissionResult) *posterMetadata {
+	meta := &posterMetadata{
+		ID:             user.ID,
+		Title:          user.Title,
+		Authors:        user.Authors,
+		Session:        user.Session,
+		Topic:          user.Topic,
+		AbstractNumber: user.AbstractNumber,
+		Abstract:       user.Abstract,
+		VideoURL:       current.VideoURL,
+		Updated:        time.Now(),
+	}
+	if current.Poster != nil {
+		meta.Poster = current.Poster.Name
+		meta.PosterSHA1 = current.Poster.SHA1
+	}
+	if current.Thumbnail != nil {
+		meta.Thumbnail = current.Thumbnail.Name
+	}
+	if current.Preview != nil {
+		meta.Preview = current.Preview.Name
+	}
+	if current.Video != nil {
+		meta.Video = current.Video.Name
+	}
+	return meta
+}
+
+// marshal encodes the metadata in the provided format.
+func (meta *posterMetadata) marshal(format string) ([]byte, error) {
+	if format == metadataYAML {
+		return yaml.Marshal(meta)
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// metadataFiles returns the contents of the metadata files of a poster by
+// name, rendering the README with the provided template. There are no
+// files if nothing is stored for the poster.
+func metadataFiles(cfg *Config, readme *texttemplate.Template, user *BCPoster, current *submissionResult) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if current.Poster == nil && current.Video == nil && current.VideoURL == "" {
+		return files, nil
+	}
+	var err error
+	meta := newPosterMetadata(user, current)
+	if files[metadataName(cfg, user.ID)], err = meta.marshal(cfg.MetadataFormat); err != nil {
+		return nil, err
+	}
+	if cfg.MetadataReadme {
+		var buf bytes.Buffer
+		if err := readme.Execute(&buf, meta); err != nil {
+			return nil, err
+		}
+		files[user.ID+readmeSuffix] = buf.Bytes()
+	}
+	return files, nil
+}
+
+// writeMetadata regenerates the metadata files of a poster from the posters
+// file and the currently stored files. The files are removed if nothing is
+// stored for the poster.
+func writeMetadata(cfg *Config, readme *texttemplate.Template, id string) error {
+	user, err := findPoster(cfg, id)
+	if err != nil {
+		return err
+	}
+	current, err := currentSubmission(cfg, user)
+	if err != nil {
+		return err
+	}
+	files, err := metadataFiles(cfg, readme, user, current)
+	if err != nil {
+		return err
+	}
+	store := newStorage(cfg)
+	for name, data := range files {
+		if err := store.Save(name, bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	// files of other formats are stale after a configuration change
+	for _, name := range metadataNames(id) {
+		if files[name] != nil {
+			continue
+		}
+		if err := store.Delete(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
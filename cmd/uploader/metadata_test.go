@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMetadata(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	req := newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key", "video_url": "https://example.com/video"}, files)
+	uploader.Web.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	data, err := ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, "id-meta.json"))
+	if err != nil {
+		t.Fatalf("Metadata not written: %v", err)
+	}
+	meta := posterMetadata{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("Invalid metadata: %v", err)
+	}
+	if meta.ID != "id" || meta.Title != "Title" || meta.Authors != "Author" || meta.Poster != "id.pdf" ||
+		meta.PosterSHA1 != sha1String("%PDF-1.4 test") || meta.VideoURL != "https://example.com/video" {
+		t.Fatalf("Unexpected metadata %+v", meta)
+	}
+
+	// re-uploads regenerate the metadata in the configured format
+	cfg.MetadataFormat = metadataYAML
+	cfg.MetadataReadme = true
+	req = newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key", "video_url": "https://example.com/new"}, nil)
+	uploader.Web.Router.ServeHTTP(httptest.NewRecorder(), req)
+	if _, err := os.Stat(filepath.Join(cfg.UploadDirectory, "id-meta.json")); !os.IsNotExist(err) {
+		t.Fatalf("Stale JSON metadata not removed: %v", err)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, "id-meta.yaml"))
+	if err != nil {
+		t.Fatalf("Metadata not written: %v", err)
+	}
+	meta = posterMetadata{}
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("Invalid metadata: %v", err)
+	}
+	if meta.Poster != "id.pdf" || meta.VideoURL != "https://example.com/new" {
+		t.Fatalf("Unexpected metadata %+v", meta)
+	}
+	readme, err := ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, "id-README.md"))
+	if err != nil {
+		t.Fatalf("README not written: %v", err)
+	}
+	for _, expected := range []string{"# Title\n", "- [Poster](id.pdf)", "- [Video](https://example.com/new)"} {
+		if !strings.Contains(string(readme), expected) {
+			t.Fatalf("README does not contain %q:\n%s", expected, readme)
+		}
+	}
+
+	// the metadata is updated when the video URL is cleared
+	if err := uploader.clearVideoURL(cfg, "id", actorPresenter); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, "id-meta.yaml"))
+	if strings.Contains(string(data), "video_url") {
+		t.Fatalf("Video URL not removed from metadata:\n%s", data)
+	}
+}
+
+func TestReadmeTheme(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.MetadataReadme = true
+	cfg.ThemeDirectory = filepath.Join(filepath.Dir(cfg.UploadDirectory), "theme")
+	if err := os.MkdirAll(cfg.ThemeDirectory, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cfg.ThemeDirectory, "readme.tmpl"), []byte("{{ .ID }}: {{ .Title }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newStorage(cfg).Save("id.url", strings.NewReader("https://example.com/video")); err != nil {
+		t.Fatal(err)
+	}
+	set, err := loadTemplates(cfg.ThemeDirectory)
+	if err != nil {
+		t.Fatalf("Error loading theme: %v", err)
+	}
+	if err := writeMetadata(cfg, set.readme, "id"); err != nil {
+		t.Fatalf("Error writing metadata: %v", err)
+	}
+	if readme, _ := ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, "id-README.md")); string(readme) != "id: Title" {
+		t.Fatalf("Unexpected README %q", readme)
+	}
+
+	// invalid templates are reported by the configuration check
+	if err := ioutil.WriteFile(filepath.Join(cfg.ThemeDirectory, "readme.tmpl"), []byte("{{ .ID "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `template "readme"`) {
+		t.Fatalf("Expected template error, got %v", err)
+	}
+}
+
+func TestReadmeTemplateLoadedOnce(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.MetadataReadme = true
+	cfg.ThemeDirectory = filepath.Join(filepath.Dir(cfg.UploadDirectory), "theme")
+	if err := os.MkdirAll(cfg.ThemeDirectory, 0777); err != nil {
+		t.Fatal(err)
+	}
+	readmeFile := filepath.Join(cfg.ThemeDirectory, "readme.tmpl")
+	if err := ioutil.WriteFile(readmeFile, []byte("{{ .ID }} loaded"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uploader = NewUploader(cfg)
+
+	// the template is parsed with the theme, later changes take effect on
+	// the next restart
+	if err := ioutil.WriteFile(readmeFile, []byte("{{ .ID "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	req := newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	uploader.Web.Router.ServeHTTP(httptest.NewRecorder(), req)
+	if readme, _ := ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, "id-README.md")); string(readme) != "id loaded" {
+		t.Fatalf("Unexpected README %q", readme)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf16"
+)
+
+// minTitleScore is the fraction of title words which must be found in the
+// PDF unless one of the authors is found.
+const minTitleScore = 0.5
+
+// pdfCheck is the result of comparing the text of an uploaded poster PDF
+// with the poster title and authors.
+type pdfCheck struct {
+	// Title and Author from the PDF metadata
+	Title  string `json:"title,omitempty"`
+	Author string `json:"author,omitempty"`
+	// TitleScore is the fraction of title words found in the PDF
+	TitleScore float64 `json:"title_score"`
+	// AuthorsFound lists the author surnames found in the PDF
+	AuthorsFound []string `json:"authors_found"`
+	// Mismatch is true if the PDF likely belongs to another poster
+	Mismatch bool `json:"mismatch"`
+	// PosterSHA1 is the hash of the checked PDF
+	PosterSHA1 string `json:"poster_sha1,omitempty"`
+	// Checked is the time of the check
+	Checked time.Time `json:"checked"`
+}
+
+// checkSuffix is the suffix of the file storing the check result of the
+// current poster PDF.
+const checkSuffix = "-check.json"
+
+// checkName returns the storage name of the check result of a poster.
+func checkName(id string) string {
+	return id + checkSuffix
+}
+
+var (
+	pdfInfoRe    = regexp.MustCompile(`/(Title|Author)\s*(\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>)`)
+	xmpTitleRe   = regexp.MustCompile(`(?s)<dc:title>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	xmpCreatorRe = regexp.MustCompile(`(?s)<dc:creator>(.*?)</dc:creator>`)
+	xmpItemRe    = regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`)
+	markupRe     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// pdfMetadata returns title and author from the document information
+// dictionary or the XMP metadata of a PDF. Compressed object streams are not
+// searched, so the metadata of some PDFs is not found.
+func pdfMetadata(data []byte) (string, string) {
+	var title, author string
+	// later entries are incremental updates of earlier ones
+	for _, match := range pdfInfoRe.FindAllSubmatch(data, -1) {
+		value := decodePDFString(string(match[2]))
+		if string(match[1]) == "Title" {
+			title = value
+		} else {
+			author = value
+		}
+	}
+	if title == "" {
+		if match := xmpTitleRe.FindSubmatch(data); match != nil {
+			title = html.UnescapeString(string(match[1]))
+		}
+	}
+	if author == "" {
+		if match := xmpCreatorRe.FindSubmatch(data); match != nil {
+			names := make([]string, 0)
+			for _, item := range xmpItemRe.FindAllSubmatch(match[1], -1) {
+				names = append(names, html.UnescapeString(string(item[1])))
+			}
+			author = strings.Join(names, ", ")
+		}
+	}
+	return strings.TrimSpace(title), strings.TrimSpace(author)
+}
+
+// decodePDFString decodes a literal "(...)" or hexadecimal "<...>" PDF
+// string in PDFDocEncoding (approximated by Latin-1) or UTF-16BE.
+func decodePDFString(str string) string {
+	var raw []byte
+	if strings.HasPrefix(str, "<") {
+		hex := strings.Join(strings.Fields(str[1:len(str)-1]), "")
+		if len(hex)%2 == 1 {
+			hex += "0"
+		}
+		for idx := 0; idx < len(hex); idx += 2 {
+			b, _ := strconv.ParseUint(hex[idx:idx+2], 16, 8)
+			raw = append(raw, byte(b))
+		}
+	} else {
+		raw = unescapePDFLiteral(str[1 : len(str)-1])
+	}
+
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+		units := make([]uint16, 0, len(raw)/2)
+		for idx := 2; idx+1 < len(raw); idx += 2 {
+			units = append(units, uint16(raw[idx])<<8|uint16(raw[idx+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, len(raw))
+	for idx, b := range raw {
+		runes[idx] = rune(b)
+	}
+	return string(runes)
+}
+
+// pdfEscapes maps the characters following a backslash in PDF literal
+// strings to the escaped byte.
+var pdfEscapes = map[byte]byte{'n': '\n', 'r': '\r', 't': '\t', 'b': '\b', 'f': '\f', '(': '(', ')': ')', '\\': '\\'}
+
+// unescapePDFLiteral resolves the escape sequences of a PDF literal string.
+func unescapePDFLiteral(str string) []byte {
+	raw := make([]byte, 0, len(str))
+	for idx := 0; idx < len(str); idx++ {
+		if str[idx] != '\\' || idx+1 == len(str) {
+			raw = append(raw, str[idx])
+			continue
+		}
+		idx++
+		if b, ok := pdfEscapes[str[idx]]; ok {
+			raw = append(raw, b)
+			continue
+		}
+		// octal character code with up to three digits
+		end := idx
+		for end < len(str) && end < idx+3 && str[end] >= '0' && str[end] <= '7' {
+			end++
+		}
+		if end > idx {
+			b, _ := strconv.ParseUint(str[idx:end], 8, 8)
+			raw = append(raw, byte(b))
+			idx = end - 1
+		}
+		// other escaped characters and line continuations are dropped
+	}
+	return raw
+}
+
+// words splits text into lower case words.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isWordSeparator)
+}
+
+// isWordSeparator returns true for all characters except letters and digits.
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// titleWords returns the significant words of a poster title without the
+// rich text markup.
+func titleWords(title string) []string {
+	significant := make([]string, 0)
+	for _, word := range words(markupRe.ReplaceAllString(title, " ")) {
+		if len([]rune(word)) >= 4 {
+			significant = append(significant, word)
+		}
+	}
+	return significant
+}
+
+// authorSurnames returns the lower case last names of a comma, semicolon
+// or "and" separated author list.
+func authorSurnames(authors string) []string {
+	authors = strings.ReplaceAll(authors, " and ", ",")
+	surnames := make([]string, 0)
+	for _, author := range strings.FieldsFunc(authors, func(r rune) bool { return r == ',' || r == ';' }) {
+		if name := surname(author); name != "" {
+			surnames = append(surnames, strings.ToLower(name))
+		}
+	}
+	return surnames
+}
+
+// surname returns the last name of an author as written or "" if there is
+// none. Separate affiliation numbers and markers are ignored.
+func surname(author string) string {
+	names := strings.FieldsFunc(author, isWordSeparator)
+	for idx := len(names) - 1; idx >= 0; idx-- {
+		if len([]rune(names[idx])) > 1 && !unicode.IsDigit([]rune(names[idx])[0]) {
+			return names[idx]
+		}
+	}
+	return ""
+}
+
+// compareText compares title and authors of a poster with the text of the
+// PDF. The result is not a mismatch if no text is available.
+func compareText(user *BCPoster, check *pdfCheck, text string) {
+	found := make(map[string]bool)
+	for _, word := range words(text) {
+		found[word] = true
+	}
+	check.AuthorsFound = make([]string, 0)
+	if len(found) == 0 {
+		return
+	}
+
+	title := titleWords(user.Title)
+	if len(title) == 0 {
+		check.TitleScore = 1
+	} else {
+		hits := 0
+		for _, word := range title {
+			if found[word] {
+				hits++
+			}
+		}
+		check.TitleScore = float64(hits) / float64(len(title))
+	}
+	for _, surname := range authorSurnames(user.Authors) {
+		if found[surname] {
+			check.AuthorsFound = append(check.AuthorsFound, surname)
+		}
+	}
+	check.Mismatch = check.TitleScore < minTitleScore && len(check.AuthorsFound) == 0
+}
+
+// textExtractor extracts the text of the first page of a PDF file.
+type textExtractor interface {
+	ExtractText(pdfPath string) (string, error)
+}
+
+// commandExtractor extracts text with an external command such as
+// pdftotext, which prints the text. The placeholder {input} is replaced in
+// the arguments.
+type commandExtractor struct {
+	args []string
+}
+
+// ExtractText runs the command and returns its output.
+func (ce commandExtractor) ExtractText(pdfPath string) (string, error) {
+	out, err := runCommand(ce.args, strings.NewReplacer("{input}", pdfPath))
+	return string(out), err
+}
+
+// newExtractor returns the text extractor for the configuration or nil if
+// text extraction is disabled.
+func newExtractor(cfg *Config) textExtractor {
+	args := strings.Fields(cfg.PDFTextCommand)
+	if len(args) == 0 {
+		return nil
+	}
+	return commandExtractor{args: args}
+}
+
+// extractorFor returns the text extractor of the uploader, which defaults
+// to the extractor for the configuration.
+func (uploader *Uploader) extractorFor(cfg *Config) textExtractor {
+	if uploader.extractor != nil {
+		return uploader.extractor
+	}
+	return newExtractor(cfg)
+}
+
+// checkPoster compares metadata and first page text of a stored poster
+// PDF with the title and authors of the poster. Only the metadata is
+// compared without an extractor.
+func checkPoster(cfg *Config, extractor textExtractor, user *BCPoster, name string) (*pdfCheck, error) {
+	pdfPath, cleanup, err := localFile(newStorage(cfg), name)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	data, err := ioutil.ReadFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	check := &pdfCheck{Checked: time.Now()}
+	if check.PosterSHA1, err = sha1Reader(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	check.Title, check.Author = pdfMetadata(data)
+	text := ""
+	if extractor != nil {
+		if text, err = extractor.ExtractText(pdfPath); err != nil {
+			// metadata is still compared
+			log.Printf("Failed to extract text of %s: %v", pdfPath, err)
+		}
+	}
+	compareText(user, check, strings.Join([]string{check.Title, check.Author, text}, "\n"))
+	// metadata alone often only holds the name of the original document
+	if strings.TrimSpace(text) == "" {
+		check.Mismatch = false
+	}
+	if check.Mismatch {
+		log.Printf("WARNING: PDF of %q may belong to another poster (title score %.2f, metadata title %q)", user.ID, check.TitleScore, check.Title)
+	}
+	return check, nil
+}
+
+// storePosterCheck checks the current poster PDF and stores the result, so
+// the admin interface does not extract the text of all posters on every
+// request. A stale result is removed if no poster PDF is stored.
+func storePosterCheck(cfg *Config, extractor textExtractor, user *BCPoster) (*pdfCheck, error) {
+	store := newStorage(cfg)
+	check, err := checkPoster(cfg, extractor, user, user.ID+".pdf")
+	if os.IsNotExist(err) {
+		if err := store.Delete(checkName(user.ID)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(check, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Save(checkName(user.ID), bytes.NewReader(append(data, '\n'))); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// loadPosterCheck returns the stored check result of a poster.
+func loadPosterCheck(store storage, id string) (*pdfCheck, error) {
+	data, err := readStored(store, checkName(id))
+	if err != nil {
+		return nil, err
+	}
+	check := &pdfCheck{}
+	if err := json.Unmarshal([]byte(data), check); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// posterCheck is the check result of a stored poster for the admin
+// interface.
+type posterCheck struct {
+	ID    string `json:"id"`
+	Title string `json:"poster_title"`
+	pdfCheck
+}
+
+// adminPosterChecks lists the stored check results of the posters whose
+// PDF likely belongs to another poster. With ?all=true, the results of all
+// checked posters are listed. Browsers get the results as a dashboard page,
+// other clients as JSON.
+func (uploader *Uploader) adminPosterChecks(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	posters, err := loadUserList(cfg.PostersInfoFile)
+	if err != nil {
+		log.Printf("ERROR loading posters info: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	store := newStorage(cfg)
+	all := r.URL.Query().Get("all") == "true"
+	checks := make([]posterCheck, 0)
+	for _, poster := range posters {
+		check, err := loadPosterCheck(store, poster.ID)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			log.Printf("ERROR reading check of poster %q: %v", poster.ID, err)
+			continue
+		}
+		if all || check.Mismatch {
+			checks = append(checks, posterCheck{ID: poster.ID, Title: poster.Title, pdfCheck: *check})
+		}
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		writeJSON(w, http.StatusOK, checks)
+		return
+	}
+
+	data := cfg.templateData(w, r)
+	tmpl, err := uploader.templates.lookup(adminChecksPage)
+	if err != nil {
+		log.Printf("Error rendering poster checks: %v", err)
+		uploader.templates.failure(w, http.StatusInternalServerError, data, "error.formdisplay")
+		return
+	}
+	data["Checks"] = checks
+	data["All"] = all
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Error rendering poster checks: %v", err)
+	}
+}
+
+// recheckPosters checks the PDFs of the posters again and stores the
+// results. Each poster is locked while it is checked, so the result always
+// belongs to the stored PDF. It returns the number of checked posters.
+func recheckPosters(cfg *Config, extractor textExtractor, posters []BCPoster) int {
+	checked := 0
+	for idx := range posters {
+		unlock := lockPoster(posters[idx].ID)
+		check, err := storePosterCheck(cfg, extractor, &posters[idx])
+		unlock()
+		if err != nil {
+			log.Printf("ERROR checking poster %q: %v", posters[idx].ID, err)
+			continue
+		}
+		if check != nil {
+			checked++
+		}
+	}
+	log.Printf("Checked the PDFs of %d posters again", checked)
+	return checked
+}
+
+// adminRecheckPosters checks the PDFs of all posters again in the
+// background, e.g. for posters uploaded before checks were stored or after
+// the titles in the posters file were corrected. Only one recheck runs at
+// a time.
+func (uploader *Uploader) adminRecheckPosters(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	posters, err := loadUserList(cfg.PostersInfoFile)
+	if err != nil {
+		log.Printf("ERROR loading posters info: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&uploader.rechecking, 0, 1) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "posters are already being checked"})
+		return
+	}
+	extractor := uploader.extractorFor(cfg)
+	uploader.rechecks.Add(1)
+	go func() {
+		defer uploader.rechecks.Done()
+		defer atomic.StoreInt32(&uploader.rechecking, 0)
+		recheckPosters(cfg, extractor, posters)
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]int{"posters": len(posters)})
+}
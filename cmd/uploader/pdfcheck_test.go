@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubExtractor returns its text for all PDF files.
+type stubExtractor string
+
+func (se stubExtractor) ExtractText(string) (string, error) {
+	return string(se), nil
+}
+
+func TestPDFMetadata(t *testing.T) {
+	data := []byte(`%PDF-1.4
+1 0 obj << /Title (Old title) >> endobj
+2 0 obj << /Title (Neural \(networks\)\nin \344sthetics) /Author <FEFF004100FC> >> endobj
+`)
+	title, author := pdfMetadata(data)
+	if title != "Neural (networks)\nin ästhetics" {
+		t.Fatalf("Unexpected title %q", title)
+	}
+	if author != "Aü" {
+		t.Fatalf("Unexpected author %q", author)
+	}
+
+	xmp := []byte(`<x:xmpmeta><dc:title><rdf:Alt><rdf:li xml:lang="x-default">Spikes &amp; waves</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>A. Smith</rdf:li><rdf:li>B. Jones</rdf:li></rdf:Seq></dc:creator></x:xmpmeta>`)
+	title, author = pdfMetadata(xmp)
+	if title != "Spikes & waves" || author != "A. Smith, B. Jones" {
+		t.Fatalf("Unexpected XMP metadata %q, %q", title, author)
+	}
+}
+
+func TestAuthorSurnames(t *testing.T) {
+	surnames := authorSurnames("Anna Smith1,2, Bernd M. Müller3; C. Jones* and D. de Vries")
+	expected := []string{"smith1", "müller3", "jones", "vries"}
+	if strings.Join(surnames, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Unexpected surnames %v", surnames)
+	}
+}
+
+func TestCompareText(t *testing.T) {
+	user := &BCPoster{Title: "Synaptic <i>plasticity</i> in cortical circuits", Authors: "Anna Smith, Bernd Jones"}
+
+	check := &pdfCheck{}
+	compareText(user, check, "SYNAPTIC PLASTICITY IN CORTICAL CIRCUITS\nA. Smith")
+	if check.Mismatch || check.TitleScore != 1 || len(check.AuthorsFound) != 1 {
+		t.Fatalf("Unexpected check result: %+v", check)
+	}
+
+	// authors found outweigh a changed title
+	check = &pdfCheck{}
+	compareText(user, check, "A completely different title by B. Jones")
+	if check.Mismatch {
+		t.Fatalf("Unexpected mismatch: %+v", check)
+	}
+
+	check = &pdfCheck{}
+	compareText(user, check, "Grid cells in the entorhinal cortex, C. Miller")
+	if !check.Mismatch {
+		t.Fatalf("Expected mismatch: %+v", check)
+	}
+
+	// no text is not a mismatch
+	check = &pdfCheck{}
+	compareText(user, check, "")
+	if check.Mismatch {
+		t.Fatalf("Unexpected mismatch without text: %+v", check)
+	}
+}
+
+func TestSubmissionMismatchWarning(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.AdminPW = "adminsecret"
+
+	submit := func(content string) string {
+		files := map[string][2]string{"poster": {"poster.pdf", content}}
+		req := newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files)
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected status code %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	uploader.extractor = stubExtractor("Title\nAuthor")
+	if strings.Contains(submit("%PDF-1.4 test"), "ui warning message") {
+		t.Fatal("Unexpected mismatch warning")
+	}
+
+	uploader.extractor = stubExtractor("Grid cells\nC. Miller")
+	if !strings.Contains(submit("%PDF-1.4 other"), "ui warning message") {
+		t.Fatal("Mismatch warning missing")
+	}
+
+	admin := func(method, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/posters/checks", nil)
+		req.SetBasicAuth("admin", "adminsecret")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		return w
+	}
+	checks := func() []posterCheck {
+		w := admin("GET", "")
+		checks := make([]posterCheck, 0)
+		if err := json.Unmarshal(w.Body.Bytes(), &checks); err != nil {
+			t.Fatalf("Invalid JSON response: %v", err)
+		}
+		return checks
+	}
+
+	// the stored result of the upload is listed, the PDF is not checked again
+	uploader.extractor = stubExtractor("Title\nAuthor")
+	if checks := checks(); len(checks) != 1 || checks[0].ID != "id" || !checks[0].Mismatch || checks[0].PosterSHA1 != sha1String("%PDF-1.4 other") {
+		t.Fatalf("Unexpected poster checks: %+v", checks)
+	}
+	if body := admin("GET", "text/html").Body.String(); !strings.Contains(body, "likely mismatch") || !strings.Contains(body, "<strong>id</strong>") {
+		t.Fatalf("Mismatch missing on dashboard: %s", body)
+	}
+
+	// checking again stores the new results in the background
+	if w := admin("POST", ""); w.Code != http.StatusAccepted || strings.TrimSpace(w.Body.String()) != `{"posters":2}` {
+		t.Fatalf("Unexpected recheck response %d: %s", w.Code, w.Body.String())
+	}
+	uploader.rechecks.Wait()
+	if checks := checks(); len(checks) != 0 {
+		t.Fatalf("Unexpected poster checks after recheck: %+v", checks)
+	}
+}
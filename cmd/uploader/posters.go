@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// posterFieldAliases maps normalised column names and JSON keys of
+// conference management system exports to the fields of BCPoster.
+var posterFieldAliases = map[string]string{
+	"id":             "ID",
+	"posterid":       "ID",
+	"uploadkey":      "UploadKey",
+	"key":            "UploadKey",
+	"passcode":       "UploadKey",
+	"abstractnumber": "AbstractNumber",
+	"abstractno":     "AbstractNumber",
+	"abstractid":     "AbstractNumber",
+	"posternumber":   "AbstractNumber",
+	"number":         "AbstractNumber",
+	"authors":        "Authors",
+	"author":         "Authors",
+	"authorlist":     "Authors",
+	"title":          "Title",
+	"session":        "Session",
+	"topic":          "Topic",
+	"track":          "Topic",
+	"abstract":       "Abstract",
+	"abstracttext":   "Abstract",
+}
+
+// normaliseColumn returns the lower case letters and digits of a column
+// name, so "Abstract No." and "abstract_no" are the same column.
+func normaliseColumn(name string) string {
+	return strings.Join(words(name), "")
+}
+
+// parsePosterColumns reads the PostersColumns mapping of comma separated
+// field=column pairs and returns the fields by normalised column name.
+func parsePosterColumns(spec string) (map[string]string, error) {
+	columns := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || normaliseColumn(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid column mapping %q, expected field=column", pair)
+		}
+		field, ok := posterFieldAliases[normaliseColumn(parts[0])]
+		if !ok {
+			return nil, fmt.Errorf("unknown poster field %q", parts[0])
+		}
+		columns[normaliseColumn(parts[1])] = field
+	}
+	return columns, nil
+}
+
+// posterField returns the BCPoster field of a column or "" if the column is
+// not imported. Configured columns take precedence over the aliases.
+func posterField(columns map[string]string, name string) string {
+	if field, ok := columns[normaliseColumn(name)]; ok {
+		return field
+	}
+	return posterFieldAliases[normaliseColumn(name)]
+}
+
+// setPosterField sets a field of the poster by name.
+func setPosterField(poster *BCPoster, field, value string) {
+	value = strings.TrimSpace(value)
+	switch field {
+	case "ID":
+		poster.ID = value
+	case "UploadKey":
+		poster.UploadKey = value
+	case "AbstractNumber":
+		poster.AbstractNumber = value
+	case "Authors":
+		poster.Authors = value
+	case "Title":
+		poster.Title = value
+	case "Session":
+		poster.Session = value
+	case "Topic":
+		poster.Topic = value
+	case "Abstract":
+		poster.Abstract = value
+	}
+}
+
+// importPostersCSV reads posters from CSV with a header row. Columns are
+// separated by commas or, as in many spreadsheet exports, semicolons.
+func importPostersCSV(data []byte, columns map[string]string) ([]BCPoster, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	header := data
+	if idx := bytes.IndexByte(data, '\n'); idx >= 0 {
+		header = data[:idx]
+	}
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing header row")
+	}
+	fields := make([]string, len(records[0]))
+	for idx, name := range records[0] {
+		fields[idx] = posterField(columns, name)
+	}
+	posters := make([]BCPoster, 0, len(records)-1)
+	for _, record := range records[1:] {
+		poster := BCPoster{}
+		for idx, value := range record {
+			setPosterField(&poster, fields[idx], value)
+		}
+		posters = append(posters, poster)
+	}
+	return posters, nil
+}
+
+// importPostersJSON reads posters from a JSON array of objects. Numbers are
+// converted to strings and lists, e.g. of authors, are joined with commas.
+func importPostersJSON(data []byte, columns map[string]string) ([]BCPoster, error) {
+	items := make([]map[string]interface{}, 0)
+	// numbers are kept as written; as float64 large IDs and upload keys
+	// would be formatted in exponent notation
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&items); err != nil {
+		return nil, err
+	}
+	posters := make([]BCPoster, 0, len(items))
+	for _, item := range items {
+		poster := BCPoster{}
+		for key, value := range item {
+			setPosterField(&poster, posterField(columns, key), jsonString(value))
+		}
+		posters = append(posters, poster)
+	}
+	return posters, nil
+}
+
+// jsonString formats a decoded JSON value as text.
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case []interface{}:
+		parts := make([]string, len(v))
+		for idx, part := range v {
+			parts[idx] = jsonString(part)
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// importPosters reads a CSV or JSON export, detected by the file extension
+// or the content.
+func importPosters(fname string, columns map[string]string) ([]BCPoster, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(fname)); {
+	case ext == ".json":
+		return importPostersJSON(data, columns)
+	case ext == ".csv":
+		return importPostersCSV(data, columns)
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")):
+		return importPostersJSON(data, columns)
+	default:
+		return importPostersCSV(data, columns)
+	}
+}
+
+// checkPosters returns the problems of a posters list: missing or invalid
+// IDs, missing upload keys and duplicate IDs, upload keys or abstract
+// numbers. Rows are numbered from 1.
+func checkPosters(posters []BCPoster) []string {
+	problems := make([]string, 0)
+	seen := map[string]map[string][]int{"ID": {}, "UploadKey": {}, "AbstractNumber": {}}
+	for idx, poster := range posters {
+		row := idx + 1
+		if poster.ID == "" {
+			problems = append(problems, fmt.Sprintf("poster %d: missing ID", row))
+		} else if !validPosterID(poster.ID) {
+			problems = append(problems, fmt.Sprintf("poster %d: invalid ID %q", row, poster.ID))
+		}
+		if poster.UploadKey == "" {
+			problems = append(problems, fmt.Sprintf("poster %d: missing upload key", row))
+		}
+		for field, value := range map[string]string{"ID": poster.ID, "UploadKey": poster.UploadKey, "AbstractNumber": poster.AbstractNumber} {
+			if value != "" {
+				seen[field][value] = append(seen[field][value], row)
+			}
+		}
+	}
+	for _, field := range []string{"ID", "UploadKey", "AbstractNumber"} {
+		duplicates := make([]string, 0)
+		for value, rows := range seen[field] {
+			if len(rows) > 1 {
+				duplicates = append(duplicates, fmt.Sprintf("duplicate %s %q in posters %s", field, value, strings.Trim(fmt.Sprint(rows), "[]")))
+			}
+		}
+		sort.Strings(duplicates)
+		problems = append(problems, duplicates...)
+	}
+	return problems
+}
+
+// writePosters writes the posters in the canonical format read by
+// loadUserList. The file is replaced atomically, so a running server never
+// reads a partial file.
+func writePosters(fname string, posters []BCPoster) error {
+	data, err := json.MarshalIndent(posters, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpfile := fname + ".tmp"
+	if err := ioutil.WriteFile(tmpfile, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, fname)
+}
+
+// importConfiguredPosters converts a CSV or JSON export to the posters
+// info file of the configuration and returns the exit code. The file is not
+// written if any problems are found. The configuration is not validated as
+// a whole since the posters info file may not exist yet.
+func importConfiguredPosters(configFileName string, required bool, input string) int {
+	config, err := loadConfig(configFileName, required)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	columns, err := parsePosterColumns(config.PostersColumns)
+	if err != nil {
+		fmt.Printf("Invalid posterscolumns: %s\n", err.Error())
+		return 1
+	}
+	posters, err := importPosters(input, columns)
+	if err != nil {
+		fmt.Printf("Error reading %s: %s\n", input, err.Error())
+		return 1
+	}
+	fmt.Printf("%d posters read from %s\n", len(posters), input)
+	if problems := checkPosters(posters); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		fmt.Printf("%d problems found, %s not written\n", len(problems), config.PostersInfoFile)
+		return 1
+	}
+	if err := writePosters(config.PostersInfoFile, posters); err != nil {
+		fmt.Printf("Error writing posters: %s\n", err.Error())
+		return 1
+	}
+	fmt.Printf("%d posters written to %s\n", len(posters), config.PostersInfoFile)
+	return 0
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportPostersCSV(t *testing.T) {
+	columns, err := parsePosterColumns("UploadKey=Passwort, ID=Beitrag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// spreadsheet export with byte order mark, semicolons and quoted fields
+	data := "\ufeffBeitrag;Passwort;Abstract No.;Title;Authors;Unused\n" +
+		"p1;k1;W 1;\"Spikes; waves\";\"A. Smith, B. Jones\";x\n" +
+		"p2;k2;W 2;Other;C. Doe;y\n"
+	posters, err := importPostersCSV([]byte(data), columns)
+	if err != nil {
+		t.Fatalf("Error importing CSV: %v", err)
+	}
+	expected := []BCPoster{
+		{ID: "p1", UploadKey: "k1", AbstractNumber: "W 1", Title: "Spikes; waves", Authors: "A. Smith, B. Jones"},
+		{ID: "p2", UploadKey: "k2", AbstractNumber: "W 2", Title: "Other", Authors: "C. Doe"},
+	}
+	if len(posters) != len(expected) || posters[0] != expected[0] || posters[1] != expected[1] {
+		t.Fatalf("Unexpected posters %+v", posters)
+	}
+
+	if _, err := importPostersCSV([]byte("id,key\np1\n"), nil); err == nil {
+		t.Fatal("Expected error for incomplete row")
+	}
+	for _, spec := range []string{"UploadKey", "Speaker=Name", "ID="} {
+		if _, err := parsePosterColumns(spec); err == nil {
+			t.Errorf("Expected error for column mapping %q", spec)
+		}
+	}
+}
+
+func TestImportPostersJSON(t *testing.T) {
+	data := `[{"poster_id": "p1", "passcode": "k1", "abstract_number": 17, "authors": ["A. Smith", "B. Jones"],
+		"title": "Title", "track": "Topic", "session": "1", "abstract_text": "Text", "room": "A"}]`
+	posters, err := importPostersJSON([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("Error importing JSON: %v", err)
+	}
+	expected := BCPoster{ID: "p1", UploadKey: "k1", AbstractNumber: "17", Authors: "A. Smith, B. Jones",
+		Title: "Title", Topic: "Topic", Session: "1", Abstract: "Text"}
+	if len(posters) != 1 || posters[0] != expected {
+		t.Fatalf("Unexpected posters %+v", posters)
+	}
+
+	// large numbers are not converted to exponent notation
+	posters, err = importPostersJSON([]byte(`[{"id": 1234567, "key": 12345678901234567890, "number": 2.50}]`), nil)
+	if err != nil || len(posters) != 1 || posters[0] != (BCPoster{ID: "1234567", UploadKey: "12345678901234567890", AbstractNumber: "2.50"}) {
+		t.Fatalf("Unexpected posters %+v: %v", posters, err)
+	}
+}
+
+func TestCheckPosters(t *testing.T) {
+	posters := []BCPoster{
+		{ID: "p1", UploadKey: "k1", AbstractNumber: "1"},
+		{ID: "p1", UploadKey: "k2", AbstractNumber: "2"},
+		{ID: "p3", UploadKey: "k1", AbstractNumber: "2"},
+		{ID: "", UploadKey: ""},
+		{ID: "a/b", UploadKey: "k5"},
+		{ID: ".hidden", UploadKey: "k6"},
+		{ID: "p-v2", UploadKey: "k7"},
+		{ID: "p-v20221019T095249Z", UploadKey: "k8"},
+		{ID: "p-thumb", UploadKey: "k9"},
+		{ID: "p-check", UploadKey: "k10"},
+		{ID: "p-README", UploadKey: "k11"},
+		{ID: "p.1-a", UploadKey: "k12"},
+	}
+	expected := []string{
+		"poster 4: missing ID",
+		"poster 4: missing upload key",
+		`poster 5: invalid ID "a/b"`,
+		`poster 6: invalid ID ".hidden"`,
+		`poster 7: invalid ID "p-v2"`,
+		`poster 8: invalid ID "p-v20221019T095249Z"`,
+		`poster 9: invalid ID "p-thumb"`,
+		`poster 10: invalid ID "p-check"`,
+		`poster 11: invalid ID "p-README"`,
+		`duplicate ID "p1" in posters 1 2`,
+		`duplicate UploadKey "k1" in posters 1 3`,
+		`duplicate AbstractNumber "2" in posters 2 3`,
+	}
+	if problems := checkPosters(posters); strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Unexpected problems:\n%s", strings.Join(problems, "\n"))
+	}
+}
+
+func TestImportConfiguredPosters(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_import")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	postersFile := filepath.Join(tmpDir, "posters.json")
+	cfgFile := filepath.Join(tmpDir, "config")
+	cfg := "postersinfofile: " + postersFile + "\nposterscolumns: AbstractNumber=Nr\n"
+	if err := ioutil.WriteFile(cfgFile, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(tmpDir, "export.csv")
+	write := func(content string) {
+		if err := ioutil.WriteFile(input, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// duplicates are reported and nothing is written
+	write("ID,Key,Nr\np1,k1,1\np2,k1,2\n")
+	if code := importConfiguredPosters(cfgFile, true, input); code != 1 {
+		t.Fatalf("Unexpected exit code %d", code)
+	}
+	if _, err := os.Stat(postersFile); !os.IsNotExist(err) {
+		t.Fatalf("Posters file written despite problems: %v", err)
+	}
+
+	write("ID,Key,Nr\np1,k1,1\np2,k2,2\n")
+	if code := importConfiguredPosters(cfgFile, true, input); code != 0 {
+		t.Fatalf("Unexpected exit code %d", code)
+	}
+	posters, err := loadUserList(postersFile)
+	if err != nil || len(posters) != 2 || posters[1] != (BCPoster{ID: "p2", UploadKey: "k2", AbstractNumber: "2"}) {
+		t.Fatalf("Unexpected posters %+v: %v", posters, err)
+	}
+}
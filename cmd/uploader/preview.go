@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffixes of the preview images stored next to <ID>.pdf
+const (
+	thumbnailSuffix = "-thumb.png"
+	previewSuffix   = "-preview.png"
+)
+
+// renderTimeout is the maximum time a single preview may take to render
+// or external command may take to run.
+const renderTimeout = 60 * time.Second
+
+// previewRenderer renders the first page of a PDF file to a PNG image of
+// the given width in pixels.
+type previewRenderer interface {
+	Render(pdfPath, pngPath string, width int) error
+}
+
+// commandRenderer renders previews with an external command such as
+// pdftoppm. The placeholders {input}, {output}, {outputbase} (the output
+// path without the .png extension) and {width} are replaced in the
+// arguments.
+type commandRenderer struct {
+	args []string
+}
+
+// Render runs the command and fails if it does not create the image.
+func (cr commandRenderer) Render(pdfPath, pngPath string, width int) error {
+	replacer := strings.NewReplacer(
+		"{input}", pdfPath,
+		"{output}", pngPath,
+		"{outputbase}", strings.TrimSuffix(pngPath, ".png"),
+		"{width}", strconv.Itoa(width),
+	)
+	if _, err := runCommand(cr.args, replacer); err != nil {
+		return err
+	}
+	if _, err := os.Stat(pngPath); err != nil {
+		return fmt.Errorf("%s did not create %s", cr.args[0], pngPath)
+	}
+	return nil
+}
+
+// runCommand runs an external command after replacing the placeholders in
+// its arguments and returns its standard output. The command is killed
+// after renderTimeout.
+func runCommand(args []string, replacer *strings.Replacer) ([]byte, error) {
+	return runCommandTimeout(args, replacer, renderTimeout)
+}
+
+// runCommandTimeout is runCommand with a different timeout for long running
+// commands.
+func runCommandTimeout(args []string, replacer *strings.Replacer, timeout time.Duration) ([]byte, error) {
+	expanded := make([]string, len(args))
+	for idx, arg := range args {
+		expanded[idx] = replacer.Replace(arg)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, expanded[0], expanded[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", expanded[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// newRenderer returns the preview renderer for the configuration or nil if
+// previews are disabled.
+func newRenderer(cfg *Config) previewRenderer {
+	args := strings.Fields(cfg.PreviewCommand)
+	if len(args) == 0 {
+		return nil
+	}
+	return commandRenderer{args: args}
+}
+
+// rendererFor returns the preview renderer of the uploader, which defaults
+// to the renderer for the configuration.
+func (uploader *Uploader) rendererFor(cfg *Config) previewRenderer {
+	if uploader.renderer != nil {
+		return uploader.renderer
+	}
+	return newRenderer(cfg)
+}
+
+// previewNames returns the storage names of thumbnail and preview of a
+// poster.
+func previewNames(id string) (string, string) {
+	return id + thumbnailSuffix, id + previewSuffix
+}
+
+// renderPreviews replaces the thumbnail and preview images of a poster with
+// images of the first page of the current poster PDF. Images are rendered
+// to a temporary directory and then stored. Without a renderer, the images
+// are only removed.
+func renderPreviews(cfg *Config, renderer previewRenderer, id string) error {
+	store := newStorage(cfg)
+	thumbName, previewName := previewNames(id)
+	images := map[string]int{thumbName: cfg.ThumbnailWidth, previewName: cfg.PreviewWidth}
+	// remove images of the previous poster in any case
+	for name := range images {
+		if err := store.Delete(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if renderer == nil {
+		return nil
+	}
+
+	pdfPath, cleanup, err := localFile(store, id+".pdf")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	tmpDir, err := ioutil.TempDir("", "uploader-preview")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	for name, width := range images {
+		path := filepath.Join(tmpDir, name)
+		if err := renderer.Render(pdfPath, path, width); err != nil {
+			return err
+		}
+		image, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = store.Save(name, image)
+		image.Close()
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Previews of %q rendered", id)
+	return nil
+}
+
+// currentPreviews returns the stored thumbnail and preview of a poster;
+// missing images are nil.
+func currentPreviews(cfg *Config, id string) (*storedFile, *storedFile, error) {
+	store := newStorage(cfg)
+	thumbName, previewName := previewNames(id)
+	thumb, err := statStored(store, thumbName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	preview, err := statStored(store, previewName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	return thumb, preview, nil
+}
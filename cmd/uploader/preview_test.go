@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubRenderer writes the rendered width instead of an image.
+type stubRenderer struct{}
+
+func (stubRenderer) Render(pdfPath, pngPath string, width int) error {
+	if _, err := os.Stat(pdfPath); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pngPath, []byte(fmt.Sprint(width)), 0644)
+}
+
+func TestSubmissionPreviews(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	uploader.renderer = stubRenderer{}
+	cfg := uploader.Config()
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	req := newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files)
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `src="/uploads/id-preview.png"`) {
+		t.Fatal("Preview missing on success page")
+	}
+
+	thumb, preview, err := currentPreviews(cfg, "id")
+	if err != nil || thumb == nil || preview == nil {
+		t.Fatalf("Previews not stored: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, thumb.Name)); string(data) != fmt.Sprint(cfg.ThumbnailWidth) {
+		t.Fatalf("Unexpected thumbnail content %q", data)
+	}
+	// no temporary files are left behind
+	if err := checkDirFiles(cfg.UploadDirectory, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a renderer, previews of older posters are removed
+	uploader.renderer = nil
+	files = map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 updated"}}
+	req = newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files)
+	uploader.Web.Router.ServeHTTP(httptest.NewRecorder(), req)
+	if thumb, preview, _ := currentPreviews(cfg, "id"); thumb != nil || preview != nil {
+		t.Fatal("Outdated previews not removed")
+	}
+}
+
+func TestWithdrawPreviews(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	uploader.renderer = stubRenderer{}
+	cfg := uploader.Config()
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	req := newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files)
+	uploader.Web.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	moved, err := withdrawPoster(cfg, "id", actorPresenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 5 {
+		t.Fatalf("Expected poster, previews, check result and metadata to be withdrawn, got %v", moved)
+	}
+}
+
+func TestCommandRenderer(t *testing.T) {
+	if _, err := exec.LookPath("cp"); err != nil {
+		t.Skip("cp not available")
+	}
+	tmpDir, err := ioutil.TempDir("", "test_bc_preview")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	input := filepath.Join(tmpDir, "in.pdf")
+	if err := ioutil.WriteFile(input, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	renderer := commandRenderer{args: []string{"cp", "{input}", "{outputbase}.png"}}
+	output := filepath.Join(tmpDir, "out.png")
+	if err := renderer.Render(input, output, 100); err != nil {
+		t.Fatalf("Unexpected render error: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(output); string(data) != "%PDF-1.4" {
+		t.Fatalf("Unexpected output %q", data)
+	}
+
+	// commands not creating the output fail
+	renderer = commandRenderer{args: []string{"true", "{input}"}}
+	if err := renderer.Render(input, filepath.Join(tmpDir, "missing.png"), 100); err == nil {
+		t.Fatal("Expected error for missing output")
+	}
+}
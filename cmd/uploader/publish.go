@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// gitTimeout is the maximum run time of a single git command.
+const gitTimeout = 10 * time.Minute
+
+// publishRetryDelay is the delay before the second attempt to publish a
+// poster; it doubles with each further attempt up to publishMaxDelay.
+const (
+	publishRetryDelay = time.Minute
+	publishMaxDelay   = time.Hour
+)
+
+// publishRecent is the number of published posters listed for admins.
+const publishRecent = 50
+
+// publishJob is a poster waiting to be published to the gallery
+// repository.
+type publishJob struct {
+	ID string `json:"id"`
+	// Queued is the time of the latest request to publish the poster
+	Queued      time.Time `json:"queued"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	// Failed is set when all attempts failed; the job is kept until the
+	// poster is requeued
+	Failed bool `json:"failed,omitempty"`
+}
+
+// publishedPoster records a finished publication.
+type publishedPoster struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Commit is the commit pushed to the gallery, empty if nothing changed
+	Commit string `json:"commit,omitempty"`
+}
+
+// publisher commits the current files of submitted posters to the gallery
+// repository. Jobs are processed one at a time by a single worker and the
+// queue is saved to PublishQueueFile after every change, so pending jobs
+// survive a restart.
+type publisher struct {
+	sync.Mutex
+	config func() *Config
+	// readme is the template of the README published with the metadata
+	readme *texttemplate.Template
+	jobs   []*publishJob
+	recent []publishedPoster
+	wake   chan struct{}
+}
+
+// newPublisher returns a publisher with the queue loaded from the queue
+// file of the configuration.
+func newPublisher(config func() *Config, readme *texttemplate.Template) (*publisher, error) {
+	pub := &publisher{config: config, readme: readme, jobs: make([]*publishJob, 0), wake: make(chan struct{}, 1)}
+	data, err := ioutil.ReadFile(config().PublishQueueFile)
+	if os.IsNotExist(err) {
+		return pub, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &pub.jobs); err != nil {
+		return nil, fmt.Errorf("invalid publish queue file %q: %v", config().PublishQueueFile, err)
+	}
+	return pub, nil
+}
+
+// save writes the queue; the caller must hold the lock.
+func (pub *publisher) save() error {
+	data, err := json.MarshalIndent(pub.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	fname := pub.config().PublishQueueFile
+	tmpfile := fname + ".tmp"
+	if err := ioutil.WriteFile(tmpfile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, fname)
+}
+
+// Enqueue requests publishing the current files of a poster. Pending and
+// failed jobs for the same poster are restarted instead of added again.
+func (pub *publisher) Enqueue(id string) {
+	pub.Lock()
+	now := time.Now()
+	var job *publishJob
+	for _, queued := range pub.jobs {
+		if queued.ID == id {
+			job = queued
+			break
+		}
+	}
+	if job == nil {
+		job = &publishJob{ID: id}
+		pub.jobs = append(pub.jobs, job)
+	}
+	job.Queued = now
+	job.Attempts = 0
+	job.NextAttempt = now
+	job.Failed = false
+	if err := pub.save(); err != nil {
+		log.Printf("ERROR saving publish queue: %v", err)
+	}
+	pub.Unlock()
+	log.Printf("Poster %q queued for publishing", id)
+
+	select {
+	case pub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns copies of the queued jobs and the recently published
+// posters, newest first.
+func (pub *publisher) Status() ([]publishJob, []publishedPoster) {
+	pub.Lock()
+	defer pub.Unlock()
+	jobs := make([]publishJob, len(pub.jobs))
+	for idx, job := range pub.jobs {
+		jobs[idx] = *job
+	}
+	recent := make([]publishedPoster, len(pub.recent))
+	for idx, published := range pub.recent {
+		recent[len(recent)-1-idx] = published
+	}
+	return jobs, recent
+}
+
+// Run processes jobs until the process ends.
+func (pub *publisher) Run() {
+	for {
+		wait := pub.Process()
+		select {
+		case <-pub.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Process publishes all due jobs and returns the time until the next
+// retry.
+func (pub *publisher) Process() time.Duration {
+	for {
+		pub.Lock()
+		var job *publishJob
+		now := time.Now()
+		next := publishMaxDelay
+		for _, queued := range pub.jobs {
+			if queued.Failed {
+				continue
+			}
+			if !queued.NextAttempt.After(now) {
+				job = queued
+				break
+			}
+			if wait := queued.NextAttempt.Sub(now); wait < next {
+				next = wait
+			}
+		}
+		if job == nil {
+			pub.Unlock()
+			return next
+		}
+		id, queued := job.ID, job.Queued
+		pub.Unlock()
+
+		commit, err := publishPoster(pub.config(), pub.readme, id)
+
+		pub.Lock()
+		// the poster may have been queued again while publishing
+		requeued := !job.Queued.Equal(queued)
+		if err != nil && requeued {
+			log.Printf("ERROR publishing poster %q; retrying for the new request: %v", id, err)
+		} else if err != nil {
+			job.Attempts++
+			job.LastError = err.Error()
+			delay := publishRetryDelay << uint(job.Attempts-1)
+			if delay > publishMaxDelay || delay <= 0 {
+				delay = publishMaxDelay
+			}
+			job.NextAttempt = time.Now().Add(delay)
+			if job.Attempts >= pub.config().PublishAttempts {
+				job.Failed = true
+				log.Printf("ERROR publishing poster %q failed %d times; giving up: %v", id, job.Attempts, err)
+			} else {
+				log.Printf("ERROR publishing poster %q (attempt %d, retry at %s): %v", id, job.Attempts, job.NextAttempt.Format(time.RFC3339), err)
+			}
+		} else {
+			pub.recent = append(pub.recent, publishedPoster{ID: id, Time: time.Now(), Commit: commit})
+			if len(pub.recent) > publishRecent {
+				pub.recent = pub.recent[len(pub.recent)-publishRecent:]
+			}
+			if !requeued {
+				pub.remove(job)
+			}
+		}
+		if err := pub.save(); err != nil {
+			log.Printf("ERROR saving publish queue: %v", err)
+		}
+		pub.Unlock()
+	}
+}
+
+// remove deletes a job from the queue; the caller must hold the lock.
+func (pub *publisher) remove(job *publishJob) {
+	for idx, queued := range pub.jobs {
+		if queued == job {
+			pub.jobs = append(pub.jobs[:idx], pub.jobs[idx+1:]...)
+			return
+		}
+	}
+}
+
+// runGit runs a git command in dir and returns its trimmed output.
+func runGit(cfg *Config, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if cfg.GallerySSHKey != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %q -o IdentitiesOnly=yes -o BatchMode=yes", cfg.GallerySSHKey))
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// initGalleryClone creates an empty repository in the work directory with
+// the gallery repository as origin.
+func initGalleryClone(cfg *Config) error {
+	dir := cfg.PublishWorkDirectory
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	repository := cfg.GalleryRepository
+	// local paths are relative to the working directory of the uploader
+	if _, err := os.Stat(repository); err == nil {
+		if repository, err = filepath.Abs(repository); err != nil {
+			return err
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", repository},
+		{"symbolic-ref", "HEAD", "refs/heads/" + cfg.GalleryBranch},
+	} {
+		if _, err := runGit(cfg, dir, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareGalleryClone updates the work directory to the current state of
+// the gallery branch. Local changes and commits which were not pushed are
+// discarded; they are recreated by the jobs still in the queue.
+func prepareGalleryClone(cfg *Config) error {
+	dir := cfg.PublishWorkDirectory
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err := initGalleryClone(cfg); err != nil {
+			return err
+		}
+	}
+	if _, err := runGit(cfg, dir, "fetch", "-q", "--prune", "origin"); err != nil {
+		return err
+	}
+	remoteBranch := "refs/remotes/origin/" + cfg.GalleryBranch
+	if _, err := runGit(cfg, dir, "rev-parse", "-q", "--verify", remoteBranch); err != nil {
+		// the branch does not exist yet, e.g. in a new repository
+		return initGalleryClone(cfg)
+	}
+	if _, err := runGit(cfg, dir, "checkout", "-q", "-f", "-B", cfg.GalleryBranch, remoteBranch); err != nil {
+		return err
+	}
+	_, err := runGit(cfg, dir, "clean", "-q", "-f", "-d", "-x")
+	return err
+}
+
+// galleryFiles copies the current poster, video URL and preview images of
+// a poster to the work directory and writes its metadata files, or removes
+// them if they are no longer stored. Videos are too large for the gallery
+// repository, so they are neither published nor referenced in the
+// published metadata. It returns false if no files are stored for the
+// poster.
+func galleryFiles(cfg *Config, readme *texttemplate.Template, id string) (bool, error) {
+	user, err := findPoster(cfg, id)
+	if err != nil {
+		return false, err
+	}
+	current, err := currentSubmission(cfg, user)
+	if err != nil {
+		return false, err
+	}
+	current.Video = nil
+	metadata, err := metadataFiles(cfg, readme, user, current)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range metadataNames(id) {
+		target := filepath.Join(cfg.PublishWorkDirectory, name)
+		if metadata[name] == nil {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(target, metadata[name], 0666); err != nil {
+			return false, err
+		}
+	}
+
+	store := newStorage(cfg)
+	published := len(metadata) > 0
+	thumbName, previewName := previewNames(id)
+	for _, name := range []string{id + ".pdf", id + ".url", thumbName, previewName} {
+		target := filepath.Join(cfg.PublishWorkDirectory, name)
+		content, err := store.Open(name)
+		if os.IsNotExist(err) {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		err = saveFile(content, target)
+		content.Close()
+		if err != nil {
+			return false, err
+		}
+		published = true
+	}
+	return published, nil
+}
+
+// publishPoster commits the current files of a poster to the gallery
+// repository and pushes the commit. It returns the commit hash, or an
+// empty string if the gallery was already up to date.
+func publishPoster(cfg *Config, readme *texttemplate.Template, id string) (string, error) {
+	dir := cfg.PublishWorkDirectory
+	if err := prepareGalleryClone(cfg); err != nil {
+		return "", err
+	}
+	published, err := galleryFiles(cfg, readme, id)
+	if err != nil {
+		return "", err
+	}
+	if _, err := runGit(cfg, dir, "add", "-A"); err != nil {
+		return "", err
+	}
+	if _, err := runGit(cfg, dir, "diff", "--cached", "--quiet"); err == nil {
+		log.Printf("Gallery repository already up to date for poster %q", id)
+		return "", nil
+	}
+
+	message := fmt.Sprintf("Update poster %s", id)
+	if !published {
+		message = fmt.Sprintf("Remove poster %s", id)
+	}
+	author, err := mail.ParseAddress(cfg.GalleryCommitAuthor)
+	if err != nil {
+		return "", err
+	}
+	if _, err := runGit(cfg, dir, "-c", "user.name="+author.Name, "-c", "user.email="+author.Address,
+		"commit", "-q", "-m", message); err != nil {
+		return "", err
+	}
+	if _, err := runGit(cfg, dir, "push", "-q", "origin", "HEAD:refs/heads/"+cfg.GalleryBranch); err != nil {
+		return "", err
+	}
+	commit, err := runGit(cfg, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Poster %q published to the gallery repository in commit %s", id, commit)
+	return commit, nil
+}
+
+// publish queues a poster for publishing if publishing is enabled.
+func (uploader *Uploader) publish(id string) {
+	if uploader.publisher != nil {
+		uploader.publisher.Enqueue(id)
+	}
+}
+
+// adminPublishStatus lists the publishing queue and recently published
+// posters.
+func (uploader *Uploader) adminPublishStatus(w http.ResponseWriter, r *http.Request) {
+	if uploader.publisher == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": false})
+		return
+	}
+	jobs, recent := uploader.publisher.Status()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":   true,
+		"branch":    uploader.Config().GalleryBranch,
+		"queue":     jobs,
+		"published": recent,
+	})
+}
+
+// adminPublish queues a poster for publishing, e.g. to retry a failed job.
+func (uploader *Uploader) adminPublish(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if uploader.publisher == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "publishing is disabled"})
+		return
+	}
+	uploader.publisher.Enqueue(id)
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id, "action": "publish"})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestPublisher enables publishing to a new bare repository next to the
+// upload directory and returns the repository path.
+func newTestPublisher(t *testing.T, uploader *Uploader) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	cfg := uploader.Config()
+	cfg.GalleryRepository = filepath.Join(filepath.Dir(cfg.UploadDirectory), "gallery.git")
+	if _, err := runGit(cfg, filepath.Dir(cfg.UploadDirectory), "init", "-q", "--bare", cfg.GalleryRepository); err != nil {
+		t.Fatalf("Error creating gallery repository: %v", err)
+	}
+	pub, err := newPublisher(uploader.Config, uploader.templates.readme)
+	if err != nil {
+		t.Fatalf("Error creating publisher: %v", err)
+	}
+	uploader.publisher = pub
+	return cfg.GalleryRepository
+}
+
+// galleryFile returns the content of a file on the gallery branch.
+func galleryFile(cfg *Config, name string) (string, error) {
+	return runGit(cfg, cfg.GalleryRepository, "show", cfg.GalleryBranch+":"+name)
+}
+
+func TestPublish(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	newTestPublisher(t, uploader)
+	uploader.renderer = stubRenderer{}
+	cfg := uploader.Config()
+	cfg.AdminPW = "adminsecret"
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	req := newSubmissionRequest(t, "/api/v1/submissions", map[string]string{"video_url": "https://example.com/video"}, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status code %d: %s", w.Code, w.Body.String())
+	}
+	if jobs, _ := uploader.publisher.Status(); len(jobs) != 1 || jobs[0].ID != "id" {
+		t.Fatalf("Unexpected publish queue %+v", jobs)
+	}
+
+	// videos are kept out of the gallery
+	if err := newStorage(cfg).Save("id.mp4", strings.NewReader("video mp4 h264 aac")); err != nil {
+		t.Fatal(err)
+	}
+
+	uploader.publisher.Process()
+	if data, err := galleryFile(cfg, "id.pdf"); err != nil || data != "%PDF-1.4 test" {
+		t.Fatalf("Unexpected poster in gallery %q: %v", data, err)
+	}
+	for _, name := range []string{"id-thumb.png", "id-preview.png"} {
+		if _, err := galleryFile(cfg, name); err != nil {
+			t.Fatalf("Preview image %s not in gallery: %v", name, err)
+		}
+	}
+	if _, err := galleryFile(cfg, "id.mp4"); err == nil {
+		t.Fatal("Video published to gallery")
+	}
+	if data, err := galleryFile(cfg, "id.url"); err != nil || data != "https://example.com/video" {
+		t.Fatalf("Unexpected video URL in gallery %q: %v", data, err)
+	}
+	data, err := galleryFile(cfg, "id-meta.json")
+	meta := posterMetadata{}
+	if err != nil || json.Unmarshal([]byte(data), &meta) != nil {
+		t.Fatalf("Invalid metadata in gallery %q: %v", data, err)
+	}
+	if meta.Title != "Title" || meta.VideoURL != "https://example.com/video" || meta.PosterSHA1 != sha1String("%PDF-1.4 test") ||
+		meta.Thumbnail != "id-thumb.png" || meta.Preview != "id-preview.png" || meta.Video != "" {
+		t.Fatalf("Unexpected metadata %+v", meta)
+	}
+	jobs, recent := uploader.publisher.Status()
+	if len(jobs) != 0 || len(recent) != 1 || recent[0].Commit == "" {
+		t.Fatalf("Unexpected publish status %+v, %+v", jobs, recent)
+	}
+
+	// an identical re-upload is not published again
+	req = newSubmissionRequest(t, "/api/v1/submissions", map[string]string{"video_url": "https://example.com/video"}, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	uploader.Web.Router.ServeHTTP(httptest.NewRecorder(), req)
+	if jobs, _ := uploader.publisher.Status(); len(jobs) != 0 {
+		t.Fatalf("Unchanged submission queued for publishing %+v", jobs)
+	}
+
+	// clearing the video URL removes it from the gallery
+	if err := uploader.clearVideoURL(cfg, "id", actorPresenter); err != nil {
+		t.Fatal(err)
+	}
+	uploader.publish("id")
+	uploader.publisher.Process()
+	if _, err := galleryFile(cfg, "id.url"); err == nil {
+		t.Fatal("Video URL not removed from gallery")
+	}
+
+	// withdrawn posters are removed
+	req = httptest.NewRequest("POST", "/admin/posters/id/withdraw", nil)
+	req.SetBasicAuth("admin", "adminsecret")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", w.Code)
+	}
+	uploader.publisher.Process()
+	if files, err := runGit(cfg, cfg.GalleryRepository, "ls-tree", "--name-only", cfg.GalleryBranch); err != nil || files != "" {
+		t.Fatalf("Unexpected files left in gallery %q: %v", files, err)
+	}
+	if _, recent := uploader.publisher.Status(); len(recent) != 3 || recent[0].ID != "id" || recent[0].Commit == "" {
+		t.Fatalf("Unexpected recently published posters %+v", recent)
+	}
+}
+
+func TestPublishRetry(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	repository := newTestPublisher(t, uploader)
+	cfg := uploader.Config()
+	cfg.AdminPW = "adminsecret"
+	cfg.PublishAttempts = 2
+	store := newStorage(cfg)
+	if err := store.Save("id.pdf", strings.NewReader("%PDF-1.4 test")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the repository is unavailable
+	if err := os.Rename(repository, repository+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	uploader.publish("id")
+	if wait := uploader.publisher.Process(); wait <= 0 || wait > publishRetryDelay {
+		t.Fatalf("Unexpected retry delay %v", wait)
+	}
+	jobs, _ := uploader.publisher.Status()
+	if len(jobs) != 1 || jobs[0].Attempts != 1 || jobs[0].LastError == "" || jobs[0].Failed {
+		t.Fatalf("Unexpected publish queue %+v", jobs)
+	}
+
+	// the queue is loaded again after a restart
+	pub, err := newPublisher(uploader.Config, uploader.templates.readme)
+	if err != nil {
+		t.Fatalf("Error loading publish queue: %v", err)
+	}
+	uploader.publisher = pub
+	uploader.publisher.jobs[0].NextAttempt = time.Now()
+	uploader.publisher.Process()
+	jobs, _ = uploader.publisher.Status()
+	if len(jobs) != 1 || jobs[0].Attempts != 2 || !jobs[0].Failed {
+		t.Fatalf("Expected failed job, got %+v", jobs)
+	}
+
+	// failed jobs are retried when requeued by an admin
+	if err := os.Rename(repository+".moved", repository); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/admin/posters/id/publish", nil)
+	req.SetBasicAuth("admin", "adminsecret")
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected status code %d", w.Code)
+	}
+	uploader.publisher.Process()
+	if data, err := galleryFile(cfg, "id.pdf"); err != nil || data != "%PDF-1.4 test" {
+		t.Fatalf("Unexpected poster in gallery %q: %v", data, err)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/publish", nil)
+	req.SetBasicAuth("admin", "adminsecret")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	status := struct {
+		Enabled   bool
+		Queue     []publishJob
+		Published []publishedPoster
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || !status.Enabled || len(status.Queue) != 0 || len(status.Published) != 1 {
+		t.Fatalf("Unexpected publish status %s: %v", w.Body.String(), err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+)
+
+// storageMetrics exposes the storage usage and rejected submissions on
+// /admin/metrics.
+var storageMetrics = expvar.NewMap("storage")
+
+// Reasons for rejecting submissions because of the storage.
+const (
+	rejectedFreeSpace   = "rejected_free_space"
+	rejectedTotalQuota  = "rejected_total_quota"
+	rejectedPosterQuota = "rejected_poster_quota"
+)
+
+// mib is the number of bytes in a MiB, the unit of all storage limits.
+const mib = 1024 * 1024
+
+// storageUsage is the space used by stored files including older versions.
+type storageUsage struct {
+	Total   int64            `json:"total"`
+	Files   int              `json:"files"`
+	Posters map[string]int64 `json:"posters"`
+}
+
+// measureUsage sums the sizes of all stored files starting with prefix.
+// Files not belonging to a poster only count towards the total. The sizes
+// are taken from the listing where the backend supports it.
+func measureUsage(store storage, prefix string) (*storageUsage, error) {
+	sizes, err := listSizes(store, prefix)
+	if err != nil {
+		return nil, err
+	}
+	usage := &storageUsage{Posters: make(map[string]int64)}
+	for name, size := range sizes {
+		usage.Total += size
+		usage.Files++
+		if id, _, _, ok := parseStoredName(name); ok {
+			usage.Posters[id] += size
+		}
+	}
+	return usage, nil
+}
+
+// storageAlert logs that a submission was rejected because of the storage
+// and counts it in the metrics.
+func storageAlert(reason, format string, args ...interface{}) {
+	storageMetrics.Add(reason, 1)
+	log.Printf("ALERT storage: "+format, args...)
+}
+
+// checkFreeSpace refuses requests of the provided size if less than the
+// minimum free space would be left in the upload directory. Free space is
+// only checked for the filesystem storage on supported platforms.
+func checkFreeSpace(cfg *Config, size int64) *submissionError {
+	if cfg.MinFreeSpace == 0 || cfg.Storage != storageFilesystem {
+		return nil
+	}
+	free, err := freeSpace(cfg.UploadDirectory)
+	if err != nil {
+		log.Printf("Free space not checked: %v", err)
+		return nil
+	}
+	storageMetrics.Set("free_bytes", intVar(int64(free)))
+	if size < 0 {
+		size = 0
+	}
+	if free < cfg.MinFreeSpace*mib+uint64(size) {
+		storageAlert(rejectedFreeSpace, "only %d MiB free in %s, %d MiB required", free/mib, cfg.UploadDirectory, cfg.MinFreeSpace)
+		return newSubmissionError(http.StatusInsufficientStorage, "storage_full", "error.storagefull")
+	}
+	return nil
+}
+
+// checkQuota refuses uploads of the provided size for a poster if they would
+// exceed the total or per-poster quota. Older versions count towards both.
+func checkQuota(cfg *Config, store storage, id string, size int64) *submissionError {
+	if cfg.PosterQuota > 0 {
+		usage, err := measureUsage(store, id)
+		if err != nil {
+			log.Printf("ERROR measuring storage usage of %q: %v", id, err)
+			return newSubmissionError(http.StatusInternalServerError, "storage_error", "error.internal")
+		}
+		if used := usage.Posters[id]; used+size > int64(cfg.PosterQuota)*mib {
+			storageAlert(rejectedPosterQuota, "submission of %q refused: %d MiB used, %d MiB uploaded, quota %d MiB", id, used/mib, size/mib, cfg.PosterQuota)
+			return newSubmissionError(http.StatusRequestEntityTooLarge, "poster_quota_exceeded", "error.posterquota", cfg.PosterQuota)
+		}
+	}
+	if cfg.StorageQuota > 0 {
+		usage, err := measureUsage(store, "")
+		if err != nil {
+			log.Printf("ERROR measuring storage usage: %v", err)
+			return newSubmissionError(http.StatusInternalServerError, "storage_error", "error.internal")
+		}
+		storageMetrics.Set("used_bytes", intVar(usage.Total))
+		if usage.Total+size > int64(cfg.StorageQuota)*mib {
+			storageAlert(rejectedTotalQuota, "submission of %q refused: %d MiB used, quota %d MiB", id, usage.Total/mib, cfg.StorageQuota)
+			return newSubmissionError(http.StatusInsufficientStorage, "storage_full", "error.storagefull")
+		}
+	}
+	return nil
+}
+
+// intVar returns an expvar integer with the provided value.
+func intVar(value int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(value)
+	return v
+}
+
+// adminStorage reports the storage usage, limits and free space.
+func (uploader *Uploader) adminStorage(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	usage, err := measureUsage(newStorage(cfg), "")
+	if err != nil {
+		log.Printf("ERROR measuring storage usage: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	storageMetrics.Set("used_bytes", intVar(usage.Total))
+	status := map[string]interface{}{
+		"usage":          usage,
+		"storage_quota":  int64(cfg.StorageQuota) * mib,
+		"poster_quota":   int64(cfg.PosterQuota) * mib,
+		"min_free_space": cfg.MinFreeSpace * mib,
+	}
+	if cfg.Storage == storageFilesystem {
+		if free, err := freeSpace(cfg.UploadDirectory); err == nil {
+			status["free_space"] = free
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
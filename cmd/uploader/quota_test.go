@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPosterQuota(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.PosterQuota = 1
+	rejected := storageMetricValue(rejectedPosterQuota)
+
+	submit := func(content string) (int, apiError) {
+		files := map[string][2]string{"poster": {"poster.pdf", content}}
+		req := newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+		req.Header.Set(uploadKeyHeader, "key")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		msg := apiError{}
+		_ = json.Unmarshal(w.Body.Bytes(), &msg)
+		return w.Code, msg
+	}
+	if code, _ := submit("%PDF-1.4 " + strings.Repeat("a", 600*1024)); code != http.StatusCreated {
+		t.Fatalf("Unexpected status code %d", code)
+	}
+	// an identical re-upload is not stored again, so it fits the quota
+	if code, msg := submit("%PDF-1.4 " + strings.Repeat("a", 600*1024)); code != http.StatusCreated {
+		t.Fatalf("Unexpected response %d: %+v", code, msg)
+	}
+	// the older version counts towards the quota
+	code, msg := submit("%PDF-1.4 " + strings.Repeat("b", 600*1024))
+	if code != http.StatusRequestEntityTooLarge || msg.Code != "poster_quota_exceeded" || !strings.Contains(msg.Message, "1 MiB") {
+		t.Fatalf("Unexpected response %d: %+v", code, msg)
+	}
+	if storageMetricValue(rejectedPosterQuota) != rejected+1 {
+		t.Fatal("Rejected submission not counted")
+	}
+
+	// other posters are not affected
+	if err := newStorage(cfg).Save("other.pdf", strings.NewReader(strings.Repeat("c", 800*1024))); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := submit("%PDF-1.4 small"); code != http.StatusCreated {
+		t.Fatalf("Unexpected status code %d", code)
+	}
+}
+
+func TestStorageQuota(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.StorageQuota = 1
+	cfg.AdminPW = "adminsecret"
+	if err := newStorage(cfg).Save("other.pdf", strings.NewReader(strings.Repeat("c", 900*1024))); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 " + strings.Repeat("a", 200*1024)}}
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files))
+	if w.Code != http.StatusInsufficientStorage || !strings.Contains(w.Body.String(), "temporarily full") {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/storage", nil)
+	req.SetBasicAuth("admin", "adminsecret")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	status := struct {
+		Usage        storageUsage `json:"usage"`
+		StorageQuota int64        `json:"storage_quota"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || status.Usage.Total != 900*1024 || status.Usage.Posters["other"] != 900*1024 || status.StorageQuota != mib {
+		t.Fatalf("Unexpected storage status %s: %v", w.Body.String(), err)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/metrics", nil)
+	req.SetBasicAuth("admin", "adminsecret")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), rejectedTotalQuota) {
+		t.Fatalf("Unexpected metrics %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMinFreeSpace(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	if _, err := freeSpace(cfg.UploadDirectory); err != nil {
+		t.Skip(err)
+	}
+	// more than any test machine has
+	cfg.MinFreeSpace = 1 << 40
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	req := newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusInsufficientStorage || !strings.Contains(w.Body.String(), "storage_full") {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// storageMetricValue returns the value of a counter in the storage metrics.
+func storageMetricValue(key string) int64 {
+	if v, ok := storageMetrics.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// vanishingStorage reports a file as missing when it is accessed after
+// being listed, as if it was pruned in the meantime.
+type vanishingStorage struct {
+	storage
+	vanished string
+}
+
+func (vs vanishingStorage) Stat(name string) (*storedFile, error) {
+	if name == vs.vanished {
+		return nil, os.ErrNotExist
+	}
+	return vs.storage.Stat(name)
+}
+
+func TestMeasureUsageVanishedFile(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	store := newStorage(uploader.Config())
+	for _, name := range []string{"id.pdf", "id.url"} {
+		if err := store.Save(name, strings.NewReader("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	usage, err := measureUsage(vanishingStorage{storage: store, vanished: "id.url"}, "")
+	if err != nil || usage.Total != 4 || usage.Files != 1 {
+		t.Fatalf("Unexpected usage %+v: %v", usage, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// reloadMutex serialises configuration reloads triggered by signal and
+// admin endpoint.
+var reloadMutex sync.Mutex
+
+// reloadResult describes the outcome of a configuration reload.
+type reloadResult struct {
+	// Changed lists all values that were changed by the reload.
+	Changed []configChange `json:"changed"`
+	// RestartRequired lists changed values that only take effect after a
+	// restart. The previous values are kept until then.
+	RestartRequired []configChange `json:"restart_required"`
+}
+
+// restartRequired returns true if changes to the Config field take effect
+// only after restarting the server.
+func restartRequired(field reflect.StructField) bool {
+	return field.Tag.Get("reload") == "restart"
+}
+
+// reloadConfig reads and validates the configuration file again and
+// atomically replaces the configuration used by the handlers. Values
+// which cannot change at runtime keep their current values and are
+// reported in the result. The active configuration is left untouched if
+// the new configuration is invalid.
+func (uploader *Uploader) reloadConfig() (*reloadResult, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	newcfg, err := loadConfig(uploader.configFile, uploader.configRequired)
+	if err != nil {
+		return nil, err
+	}
+	if err := newcfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	oldcfg := uploader.Config()
+	result := &reloadResult{
+		Changed:         make([]configChange, 0),
+		RestartRequired: make([]configChange, 0),
+	}
+	changes := diffConfig(oldcfg, newcfg)
+	oldValue := reflect.ValueOf(oldcfg).Elem()
+	newValue := reflect.ValueOf(newcfg).Elem()
+	cfgType := newValue.Type()
+	for _, change := range changes {
+		for idx := 0; idx < cfgType.NumField(); idx++ {
+			field := cfgType.Field(idx)
+			if configKey(field) != change.Key {
+				continue
+			}
+			if restartRequired(field) {
+				newValue.Field(idx).Set(oldValue.Field(idx))
+				result.RestartRequired = append(result.RestartRequired, change)
+			} else {
+				result.Changed = append(result.Changed, change)
+			}
+		}
+	}
+
+	uploader.config.Store(newcfg)
+	return result, nil
+}
+
+// reloadAndLog reloads the configuration and logs the result.
+func (uploader *Uploader) reloadAndLog() (*reloadResult, error) {
+	result, err := uploader.reloadConfig()
+	if err != nil {
+		log.Printf("Error reloading configuration; keeping current configuration: %v", err)
+		return nil, err
+	}
+	log.Printf("Configuration reloaded: %s", formatChanges(result.Changed))
+	if len(result.RestartRequired) > 0 {
+		log.Printf("Changes requiring a restart (not applied): %s", formatChanges(result.RestartRequired))
+	}
+	return result, nil
+}
+
+// adminReload reloads the configuration on request of an admin.
+func (uploader *Uploader) adminReload(w http.ResponseWriter, r *http.Request) {
+	result, err := uploader.reloadAndLog()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("reload failed: %v", err)})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_reload")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	postersFile := filepath.Join(tmpDir, "posters.json")
+	if err := ioutil.WriteFile(postersFile, []byte("[]"), 0644); err != nil {
+		t.Fatalf("Error writing posters file: %v", err)
+	}
+	cfgFile := filepath.Join(tmpDir, "config")
+	writeCfg := func(content string) {
+		content = "postersinfofile: " + postersFile + "\nwhitelistpw: pw\n" + content
+		if err := ioutil.WriteFile(cfgFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing config file: %v", err)
+		}
+	}
+
+	writeCfg("videos: false\nport: 3000\n")
+	cfg, err := loadConfig(cfgFile, true)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	uploader := NewUploader(cfg)
+	uploader.configFile = cfgFile
+	uploader.configRequired = true
+
+	writeCfg("videos: true\nport: 4000\nsubmissioncloseddate: 2020-01-01\n")
+	result, err := uploader.reloadConfig()
+	if err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	newcfg := uploader.Config()
+	if newcfg == cfg {
+		t.Fatal("Configuration was not replaced")
+	}
+	if !newcfg.Videos || newcfg.SubmissionClosedDate != "2020-01-01" {
+		t.Fatalf("Runtime values not applied: %+v", newcfg)
+	}
+	if newcfg.Port != 3000 {
+		t.Fatalf("Port changed at runtime: %d", newcfg.Port)
+	}
+	if len(result.Changed) != 2 {
+		t.Fatalf("Unexpected changes: %+v", result.Changed)
+	}
+	if len(result.RestartRequired) != 1 || result.RestartRequired[0].Key != "port" {
+		t.Fatalf("Unexpected restart required changes: %+v", result.RestartRequired)
+	}
+
+	// invalid configuration keeps the current one
+	writeCfg("keepversions: -1\n")
+	if _, err := uploader.reloadConfig(); err == nil {
+		t.Fatal("Expected error reloading invalid config")
+	}
+	if uploader.Config() != newcfg {
+		t.Fatal("Configuration replaced by invalid config")
+	}
+}
@@ -1,42 +1,58 @@
 package main
 
 import (
+	"html/template"
 	"log"
 	"net/http"
-	"text/template"
 )
 
-func success(w http.ResponseWriter, data map[string]interface{}) {
-	tmpl, err := PrepareTemplate(SuccessTmpl)
+// pageLanguage returns the page language of the template data and sets the
+// default language if the data does not specify one.
+func pageLanguage(data map[string]interface{}) string {
+	lang, ok := data["lang"].(string)
+	if !ok {
+		lang = defaultLanguage
+		data["lang"] = lang
+	}
+	return lang
+}
+
+// success renders the success page of the template set.
+func (set templateSet) success(w http.ResponseWriter, data map[string]interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	pageLanguage(data)
+	tmpl, err := set.lookup(successPage)
 	if err != nil {
-		failure(w, http.StatusInternalServerError, data, "Submission success but error occurred. Please contact...")
+		set.failure(w, http.StatusInternalServerError, data, "error.successrender")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	if err := tmpl.Execute(w, &data); err != nil {
-		failure(w, http.StatusInternalServerError, data, "Submission success but error occurred. Please contact...")
+		set.failure(w, http.StatusInternalServerError, data, "error.successrender")
 		return
 	}
 }
 
-func failure(w http.ResponseWriter, status int, data map[string]interface{}, message string) {
-	tmpl, err := PrepareTemplate(FailureTmpl)
+// failure renders the failure page with the message of the provided message
+// key translated to the page language. Unknown keys are displayed as they are.
+func (set templateSet) failure(w http.ResponseWriter, status int, data map[string]interface{}, message string, args ...interface{}) {
+	tmpl, err := set.lookup(failurePage)
 	if err != nil {
-		_, err = w.Write([]byte(message))
+		_, err = w.Write([]byte(tr(defaultLanguage, message, args...)))
 		if err != nil {
 			log.Printf("Error writing backup fail page: %v", err)
 		}
 		return
 	}
 
-	errData := map[string]interface{}{
-		"Message": message,
-	}
+	errData := map[string]interface{}{}
 	// Handle conference page link and support email in the page header
 	if data != nil {
 		errData = data
-		errData["Message"] = message
 	}
+	errData["Message"] = tr(pageLanguage(errData), message, args...)
 
 	w.WriteHeader(status)
 	if err := tmpl.Execute(w, &errData); err != nil {
@@ -48,10 +64,16 @@ func failure(w http.ResponseWriter, status int, data map[string]interface{}, mes
 // PrepareTemplate integrates a provided contentTemplate with the main
 // layout template and returns the resulting template.
 func PrepareTemplate(contentTemplate string) (*template.Template, error) {
-	tmpl := template.New("layout")
-	tmpl, err := tmpl.Parse(Layout)
+	return parsePage(Layout, contentTemplate)
+}
+
+// parsePage integrates a content template with a layout template and
+// returns the resulting template.
+func parsePage(layout, content string) (*template.Template, error) {
+	tmpl := template.New("layout").Funcs(templateFuncs)
+	tmpl, err := tmpl.Parse(layout)
 	if err != nil {
 		return nil, err
 	}
-	return tmpl.Parse(contentTemplate)
+	return tmpl.Parse(content)
 }
@@ -61,7 +61,7 @@ func TestSuccess(t *testing.T) {
 		"conferencepageurl": "conferencePageURL",
 	}
 	w := httptest.NewRecorder()
-	success(w, valDat)
+	builtinTemplates.success(w, valDat)
 	if w.Result().StatusCode != 200 {
 		t.Fatalf("Invalid header on success page: %v", w.Result().StatusCode)
 	}
@@ -87,7 +87,7 @@ func TestSuccess(t *testing.T) {
 
 	// test parsing empty success page content
 	w = httptest.NewRecorder()
-	success(w, map[string]interface{}{})
+	builtinTemplates.success(w, map[string]interface{}{})
 	if w.Result().StatusCode != 200 {
 		t.Fatalf("Invalid header on success page: %v", w.Result().StatusCode)
 	}
@@ -98,7 +98,7 @@ func TestSuccess(t *testing.T) {
 		"PosterHash": nil,
 	}
 	w = httptest.NewRecorder()
-	success(w, invalDat)
+	builtinTemplates.success(w, invalDat)
 	if w.Result().StatusCode != 200 {
 		t.Fatalf("Invalid header on success page: %v", w.Result().StatusCode)
 	}
@@ -112,7 +112,7 @@ func TestFailure(t *testing.T) {
 	contentCheck := [...]string{"supportEmail", "conferencePageURL", "failpagemessage"}
 
 	w := httptest.NewRecorder()
-	failure(w, http.StatusInternalServerError, pDat, "failpagemessage")
+	builtinTemplates.failure(w, http.StatusInternalServerError, pDat, "failpagemessage")
 	if w.Result().StatusCode != http.StatusInternalServerError {
 		t.Fatalf("Invalid header on failure page: %v", w.Result().StatusCode)
 	}
@@ -133,7 +133,7 @@ func TestFailure(t *testing.T) {
 
 	// test parsing empty page content
 	w = httptest.NewRecorder()
-	failure(w, http.StatusInternalServerError, map[string]interface{}{}, "")
+	builtinTemplates.failure(w, http.StatusInternalServerError, map[string]interface{}{}, "")
 	if w.Result().StatusCode != http.StatusInternalServerError {
 		t.Fatalf("Invalid header on failure page: %v", w.Result().StatusCode)
 	}
@@ -144,8 +144,48 @@ func TestFailure(t *testing.T) {
 		"supportemail": nil,
 	}
 	w = httptest.NewRecorder()
-	failure(w, http.StatusInternalServerError, invalDat, "")
+	builtinTemplates.failure(w, http.StatusInternalServerError, invalDat, "")
 	if w.Result().StatusCode != http.StatusInternalServerError {
 		t.Fatalf("Invalid header on failure page: %v", w.Result().StatusCode)
 	}
 }
+
+func TestSuccessEscaping(t *testing.T) {
+	// posters info and video URL are user supplied and must not be rendered as markup
+	pDat := &BCPoster{
+		Authors:  `<script>alert("authors")</script>`,
+		Title:    `<img src=x onerror=alert("title")> <i>Mus musculus</i>`,
+		Abstract: `a < b and <script>alert("abstract")</script> <b>bold</b>`,
+	}
+	valDat := map[string]interface{}{
+		"UserData":     pDat,
+		"VideoURL":     `javascript:alert("video")`,
+		"PosterHash":   `<script>alert("hash")</script>`,
+		"supportemail": `"><script>alert("email")</script>`,
+	}
+	w := httptest.NewRecorder()
+	builtinTemplates.success(w, valDat)
+	if w.Result().StatusCode != 200 {
+		t.Fatalf("Invalid header on success page: %v", w.Result().StatusCode)
+	}
+	res := w.Body.String()
+	for _, item := range []string{"<script>", "<img src=x", `href="javascript:`} {
+		if strings.Contains(res, item) {
+			t.Fatalf("Success page contains unescaped content %q", item)
+		}
+	}
+	// allowed markup and escaped text are rendered
+	for _, item := range []string{"<i>Mus musculus</i>", "<b>bold</b>", "a &lt; b", "&lt;script&gt;"} {
+		if !strings.Contains(res, item) {
+			t.Fatalf("Success page is missing %q", item)
+		}
+	}
+}
+
+func TestFailureEscaping(t *testing.T) {
+	w := httptest.NewRecorder()
+	builtinTemplates.failure(w, http.StatusBadRequest, map[string]interface{}{}, `<script>alert("message")</script>`)
+	if strings.Contains(w.Body.String(), "<script>") {
+		t.Fatal("Failure page contains unescaped message")
+	}
+}
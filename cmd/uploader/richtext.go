@@ -0,0 +1,87 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// richTextTags lists the markup elements allowed in rich text fields like
+// poster titles and abstracts. Attributes are never allowed.
+var richTextTags = map[string]bool{
+	"b":      true,
+	"i":      true,
+	"u":      true,
+	"em":     true,
+	"strong": true,
+	"sub":    true,
+	"sup":    true,
+	"p":      true,
+	"br":     true,
+}
+
+// voidTags are allowed elements without a closing tag.
+var voidTags = map[string]bool{
+	"br": true,
+}
+
+// escapedTagRe matches a tag without attributes in HTML escaped text.
+var escapedTagRe = regexp.MustCompile(`(?i)&lt;(/?)([a-z]+)\s*/?&gt;`)
+
+// richText sanitises text containing markup for rendering as HTML. The text
+// is escaped completely and only the allowed tags without attributes are
+// restored. Closing tags without a matching opening tag are dropped and
+// elements left open are closed at the end so the page layout stays intact.
+func richText(text string) template.HTML {
+	escaped := html.EscapeString(text)
+	open := make([]string, 0)
+	sanitised := escapedTagRe.ReplaceAllStringFunc(escaped, func(tag string) string {
+		match := escapedTagRe.FindStringSubmatch(tag)
+		closing := match[1] == "/"
+		name := strings.ToLower(match[2])
+		if !richTextTags[name] {
+			// keep the escaped text
+			return tag
+		}
+		if voidTags[name] {
+			if closing {
+				return ""
+			}
+			return "<" + name + ">"
+		}
+		if !closing {
+			open = append(open, name)
+			return "<" + name + ">"
+		}
+		// close all elements up to the matching opening tag
+		for idx := len(open) - 1; idx >= 0; idx-- {
+			if open[idx] != name {
+				continue
+			}
+			var closed strings.Builder
+			for jdx := len(open) - 1; jdx >= idx; jdx-- {
+				closed.WriteString("</" + open[jdx] + ">")
+			}
+			open = open[:idx]
+			return closed.String()
+		}
+		return ""
+	})
+
+	var closed strings.Builder
+	closed.WriteString(sanitised)
+	for idx := len(open) - 1; idx >= 0; idx-- {
+		closed.WriteString("</" + open[idx] + ">")
+	}
+	// the sanitised text only contains escaped text and allowed tags
+	return template.HTML(closed.String())
+}
+
+// templateFuncs are the functions available in all page templates.
+var templateFuncs = template.FuncMap{
+	"richtext": richText,
+	"tr":       tr,
+	"link":     link,
+	"linkname": linkName,
+}
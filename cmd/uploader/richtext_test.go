@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestRichText(t *testing.T) {
+	cases := map[string]string{
+		"plain text":                              "plain text",
+		"a < b & c > d":                           "a &lt; b &amp; c &gt; d",
+		"<i>italic</i> and <B>bold</B>":           "<i>italic</i> and <b>bold</b>",
+		"line<br>break<br/>":                      "line<br>break<br>",
+		"<script>alert(1)</script>":               "&lt;script&gt;alert(1)&lt;/script&gt;",
+		`<i onclick="alert(1)">x</i>`:             `&lt;i onclick=&#34;alert(1)&#34;&gt;x`,
+		"<b>unclosed":                             "<b>unclosed</b>",
+		"stray</i> close":                         "stray close",
+		"<b><i>crossed</b></i>":                   "<b><i>crossed</i></b>",
+		"H<sub>2</sub>O and x<sup>2</sup>":        "H<sub>2</sub>O and x<sup>2</sup>",
+		"<p>para</p><a href='javascript:x'>l</a>": "<p>para</p>&lt;a href=&#39;javascript:x&#39;&gt;l&lt;/a&gt;",
+	}
+	for input, expected := range cases {
+		if out := string(richText(input)); out != expected {
+			t.Fatalf("Unexpected rich text output for %q:\n%q\n%q", input, out, expected)
+		}
+	}
+}
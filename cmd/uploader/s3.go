@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Client is shared by all S3 storage values.
+var s3Client = &http.Client{Timeout: 30 * time.Minute}
+
+// s3Storage stores files as objects in a bucket of an S3 compatible object
+// storage such as MinIO. Buckets are addressed path-style and requests
+// are signed with AWS signature version 4.
+type s3Storage struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+}
+
+func newS3Storage(cfg *Config) *s3Storage {
+	return &s3Storage{
+		endpoint:  strings.TrimSuffix(cfg.S3Endpoint, "/"),
+		region:    cfg.S3Region,
+		bucket:    cfg.S3Bucket,
+		accessKey: cfg.S3AccessKey,
+		secretKey: cfg.S3SecretKey,
+	}
+}
+
+// s3URIEncode encodes a string as required for the canonical request of
+// AWS signature version 4.
+func s3URIEncode(str string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(str) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3SigningKey derives the AWS signature version 4 signing key.
+func s3SigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// sign adds the AWS signature version 4 authorisation to a request. The
+// payload is not signed.
+func (s3 *s3Storage) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, s3URIEncode(key, true)+"="+s3URIEncode(value, true))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3URIEncode(req.URL.Path, false),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	scope := date + "/" + s3.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	signature := hex.EncodeToString(hmacSHA256(s3SigningKey(s3.secretKey, date, s3.region, "s3"), stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3.accessKey, scope, signedHeaders, signature))
+}
+
+// do sends a signed request for an object, or the bucket if name is empty,
+// and returns the response if its status is 2xx or 206. Missing objects
+// result in an error satisfying os.IsNotExist.
+func (s3 *s3Storage) do(method, name string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	target := s3.endpoint + "/" + s3URIEncode(s3.bucket, true)
+	if name != "" {
+		target += "/" + s3URIEncode(name, true)
+	}
+	if len(query) > 0 {
+		target += "?" + strings.Replace(query.Encode(), "+", "%20", -1)
+	}
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Body = ioutil.NopCloser(body)
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	s3.sign(req, time.Now())
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &os.PathError{Op: strings.ToLower(method), Path: name, Err: os.ErrNotExist}
+	}
+	s3err := struct {
+		Code    string
+		Message string
+	}{}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = xml.Unmarshal(data, &s3err)
+	return nil, fmt.Errorf("S3 %s %q failed: %s %s %s", method, name, resp.Status, s3err.Code, s3err.Message)
+}
+
+// Save uploads the content with its SHA1 hash as object metadata.
+func (s3 *s3Storage) Save(name string, content io.ReadSeeker) error {
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash, err := sha1Reader(content)
+	if err != nil {
+		return err
+	}
+	size, err := content.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("X-Amz-Meta-Sha1", hash)
+	resp, err := s3.do("PUT", name, nil, header, content, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Rename copies an object and deletes the original since S3 has no rename
+// operation.
+func (s3 *s3Storage) Rename(from, to string) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+s3URIEncode(s3.bucket, true)+"/"+s3URIEncode(from, true))
+	resp, err := s3.do("PUT", to, nil, header, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// copy errors may be reported with status 200
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if strings.Contains(string(data), "<Error>") {
+		return fmt.Errorf("S3 copy %q to %q failed: %s", from, to, data)
+	}
+	return s3.Delete(from)
+}
+
+// listObjects calls fn for all objects starting with prefix.
+func (s3 *s3Storage) listObjects(prefix string, fn func(key string, size int64)) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s3.do("GET", "", query, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		result := struct {
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []struct {
+				Key  string
+				Size int64
+			}
+		}{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, object := range result.Contents {
+			fn(object.Key, object.Size)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// List uses ListObjectsV2 and follows continuation tokens.
+func (s3 *s3Storage) List(prefix string) ([]string, error) {
+	names := make([]string, 0)
+	if err := s3.listObjects(prefix, func(key string, size int64) {
+		names = append(names, key)
+	}); err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s3 *s3Storage) ListSizes(prefix string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	if err := s3.listObjects(prefix, func(key string, size int64) {
+		sizes[key] = size
+	}); err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
+
+func (s3 *s3Storage) Stat(name string) (*storedFile, error) {
+	resp, err := s3.do("HEAD", name, nil, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &storedFile{
+		Name:     name,
+		Size:     resp.ContentLength,
+		SHA1:     resp.Header.Get("X-Amz-Meta-Sha1"),
+		Modified: modified,
+	}, nil
+}
+
+// Open returns the object content. Data is requested lazily from the
+// current offset, so seeking does not download skipped data.
+func (s3 *s3Storage) Open(name string) (readSeekCloser, error) {
+	stored, err := s3.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{storage: s3, name: name, size: stored.Size}, nil
+}
+
+func (s3 *s3Storage) Delete(name string) error {
+	resp, err := s3.do("DELETE", name, nil, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// s3Object reads an object with range requests.
+type s3Object struct {
+	storage *s3Storage
+	name    string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (obj *s3Object) Read(buf []byte) (int, error) {
+	if obj.offset >= obj.size {
+		return 0, io.EOF
+	}
+	if obj.body == nil {
+		header := http.Header{}
+		header.Set("Range", "bytes="+strconv.FormatInt(obj.offset, 10)+"-")
+		resp, err := obj.storage.do("GET", obj.name, nil, header, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		obj.body = resp.Body
+	}
+	n, err := obj.body.Read(buf)
+	obj.offset += int64(n)
+	if err == io.EOF && obj.offset < obj.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (obj *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += obj.offset
+	case io.SeekEnd:
+		offset += obj.size
+	}
+	if offset < 0 {
+		return obj.offset, fmt.Errorf("seek %s: negative offset", obj.name)
+	}
+	if offset != obj.offset {
+		obj.Close()
+		obj.offset = offset
+	}
+	return offset, nil
+}
+
+func (obj *s3Object) Close() error {
+	if obj.body == nil {
+		return nil
+	}
+	err := obj.body.Close()
+	obj.body = nil
+	return err
+}
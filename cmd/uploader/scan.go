@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// clamdTimeout is the maximum time for connecting to clamd and for each
+// read and write on the connection.
+const clamdTimeout = 2 * time.Minute
+
+// clamdChunkSize is the size of the chunks streamed to clamd; it must be
+// below the StreamMaxLength of the clamd configuration.
+const clamdChunkSize = 64 * 1024
+
+// Policies for files exceeding the clamd stream size limit
+const (
+	scanOversizeRefuse = "refuse"
+	scanOversizeSkip   = "skip"
+)
+
+// errScanSizeLimit is returned for files larger than the StreamMaxLength of
+// the clamd configuration.
+var errScanSizeLimit = errors.New("file exceeds the clamd stream size limit")
+
+// scanResult is the verdict of a malware scan.
+type scanResult struct {
+	Infected bool
+	// Signature names the malware found
+	Signature string
+}
+
+// fileScanner scans file content for malware.
+type fileScanner interface {
+	Scan(content io.Reader) (scanResult, error)
+}
+
+// clamdScanner scans files with the ClamAV daemon using the INSTREAM
+// command, so clamd does not need access to the upload directory.
+type clamdScanner struct {
+	network string
+	address string
+}
+
+// newClamdScanner returns a scanner for a clamd unix socket path or a
+// host:port TCP address.
+func newClamdScanner(address string) clamdScanner {
+	if strings.Contains(address, "/") {
+		return clamdScanner{network: "unix", address: address}
+	}
+	return clamdScanner{network: "tcp", address: address}
+}
+
+// command sends a null terminated clamd command, lets send write the
+// command payload and returns the reply.
+func (cs clamdScanner) command(cmd string, send func(io.Writer) error) (string, error) {
+	conn, err := net.DialTimeout(cs.network, cs.address, clamdTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(clamdTimeout)); err != nil {
+		return "", err
+	}
+	if _, err := conn.Write([]byte("z" + cmd + "\x00")); err != nil {
+		return "", err
+	}
+	if send != nil {
+		if err := send(conn); err != nil {
+			// clamd replies with an error and closes the connection before
+			// the end of the stream, e.g. if it exceeds StreamMaxLength
+			if reply, rerr := readReply(conn); rerr == nil && reply != "" {
+				return reply, nil
+			}
+			return "", err
+		}
+	}
+	return readReply(conn)
+}
+
+// readReply reads a null terminated clamd reply.
+func readReply(conn io.Reader) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// Ping checks that clamd is available.
+func (cs clamdScanner) Ping() error {
+	reply, err := cs.command("PING", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// Scan streams the content to clamd and parses the verdict.
+func (cs clamdScanner) Scan(content io.Reader) (scanResult, error) {
+	reply, err := cs.command("INSTREAM", func(conn io.Writer) error {
+		buf := make([]byte, clamdChunkSize)
+		size := make([]byte, 4)
+		for {
+			n, err := content.Read(buf)
+			if n > 0 {
+				binary.BigEndian.PutUint32(size, uint32(n))
+				if _, err := conn.Write(append(size, buf[:n]...)); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		// a zero length chunk ends the stream
+		binary.BigEndian.PutUint32(size, 0)
+		_, err := conn.Write(size)
+		return err
+	})
+	if err != nil {
+		return scanResult{}, err
+	}
+
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return scanResult{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return scanResult{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	case strings.Contains(verdict, "size limit exceeded"):
+		return scanResult{}, errScanSizeLimit
+	default:
+		return scanResult{}, fmt.Errorf("clamd scan failed: %s", reply)
+	}
+}
+
+// newScanner returns the scanner for the configuration or nil if scanning
+// is disabled. It is replaced in tests with a fake scanner.
+var newScanner = func(cfg *Config) fileScanner {
+	if cfg.ClamdAddress == "" {
+		return nil
+	}
+	return newClamdScanner(cfg.ClamdAddress)
+}
+
+// checkClamd verifies that clamd answers if scanning is enabled.
+func checkClamd(address string) error {
+	if address == "" {
+		return nil
+	}
+	return newClamdScanner(address).Ping()
+}
+
+// quarantine writes an infected file to the quarantine directory with the
+// poster ID, time and original file name in the new name.
+func quarantine(cfg *Config, content io.ReadSeeker, id, name string) (string, error) {
+	if err := os.MkdirAll(cfg.QuarantineDirectory, 0700); err != nil {
+		return "", err
+	}
+	target := filepath.Join(cfg.QuarantineDirectory,
+		fmt.Sprintf("%s-%s-%s", id, time.Now().Format("20060102T150405"), filepath.Base(name)))
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := saveFile(content, target); err != nil {
+		return "", err
+	}
+	// quarantined files must never be served or executed
+	if err := os.Chmod(target, 0400); err != nil {
+		log.Printf("Failed to restrict permissions of %s: %v", target, err)
+	}
+	return target, nil
+}
+
+// scanUploads scans all uploaded files of a submission. Infected files are
+// quarantined and the submission is refused; if the scan fails, the
+// submission is refused as well. Files exceeding the clamd size limit are
+// refused or accepted unscanned depending on ScanOversize.
+func scanUploads(cfg *Config, id string, uploads []*upload) *submissionError {
+	scanner := newScanner(cfg)
+	if scanner == nil {
+		return nil
+	}
+	for _, upload := range uploads {
+		if _, err := upload.content.Seek(0, io.SeekStart); err != nil {
+			log.Printf("ERROR reading %q uploaded for %q: %v", upload.name, id, err)
+			return newSubmissionError(http.StatusInternalServerError, "storage_error", "error.internal")
+		}
+		result, err := scanner.Scan(upload.content)
+		if errors.Is(err, errScanSizeLimit) && cfg.ScanOversize == scanOversizeSkip {
+			log.Printf("WARNING: %q uploaded for %q not scanned: %v", upload.name, id, err)
+			continue
+		} else if errors.Is(err, errScanSizeLimit) {
+			log.Printf("Scan of %q uploaded for %q refused: %v", upload.name, id, err)
+			return newSubmissionError(http.StatusRequestEntityTooLarge, "scan_size_exceeded", "error.scantoolarge", upload.name)
+		} else if err != nil {
+			log.Printf("ERROR scanning %q uploaded for %q: %v", upload.name, id, err)
+			return newSubmissionError(http.StatusServiceUnavailable, "scan_failed", "error.scanfailed")
+		}
+		if !result.Infected {
+			log.Printf("Scan of %q uploaded for %q: clean", upload.name, id)
+			continue
+		}
+		target, err := quarantine(cfg, upload.content, id, upload.name)
+		if err != nil {
+			log.Printf("ERROR quarantining %q: %v", upload.name, err)
+			target = "(not stored)"
+		}
+		log.Printf("WARNING: Scan of %q uploaded for %q: infected with %s; quarantined as %s", upload.name, id, result.Signature, target)
+		return newSubmissionError(http.StatusUnprocessableEntity, "infected_file", "error.infected", upload.name)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeScanner reports files containing "EICAR" as infected.
+type fakeScanner struct {
+	err error
+}
+
+func (fs fakeScanner) Scan(content io.Reader) (scanResult, error) {
+	if fs.err != nil {
+		return scanResult{}, fs.err
+	}
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return scanResult{}, err
+	}
+	if bytes.Contains(data, []byte("EICAR")) {
+		return scanResult{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return scanResult{}, nil
+}
+
+// useScanner replaces the scanner until the returned function is called.
+func useScanner(scanner fileScanner) func() {
+	orig := newScanner
+	newScanner = func(*Config) fileScanner { return scanner }
+	return func() { newScanner = orig }
+}
+
+func TestSubmissionScan(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	defer useScanner(fakeScanner{})()
+	cfg := uploader.Config()
+
+	submit := func(files map[string][2]string) int {
+		req := newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+		req.Header.Set(uploadKeyHeader, "key")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := submit(map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 clean"}}); code != http.StatusCreated {
+		t.Fatalf("Unexpected status code %d for clean file", code)
+	}
+	if code := submit(map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 EICAR"}}); code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected infected file to be refused, got %d", code)
+	}
+
+	// the current poster, its check result and metadata are unchanged and
+	// no temporary files are left
+	if data, _ := ioutil.ReadFile(filepath.Join(cfg.UploadDirectory, "id.pdf")); string(data) != "%PDF-1.4 clean" {
+		t.Fatalf("Current poster replaced: %q", data)
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 3); err != nil {
+		t.Fatal(err)
+	}
+	quarantined, err := ioutil.ReadDir(cfg.QuarantineDirectory)
+	if err != nil || len(quarantined) != 1 || !strings.HasPrefix(quarantined[0].Name(), "id-") {
+		t.Fatalf("Infected file not quarantined: %v", err)
+	}
+
+	// scan failures refuse the submission
+	defer useScanner(fakeScanner{err: errors.New("clamd down")})()
+	if code := submit(map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 new"}}); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected unavailable status on scan failure, got %d", code)
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// files exceeding the clamd size limit are refused or not scanned
+	defer useScanner(fakeScanner{err: errScanSizeLimit})()
+	if code := submit(map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 large"}}); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected file exceeding the scan limit to be refused, got %d", code)
+	}
+	cfg.ScanOversize = scanOversizeSkip
+	if code := submit(map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 large"}}); code != http.StatusCreated {
+		t.Fatalf("Expected file exceeding the scan limit to be accepted, got %d", code)
+	}
+}
+
+// fakeClamdStreamMaxLength is the stream size limit of fakeClamd.
+const fakeClamdStreamMaxLength = 4 * clamdChunkSize
+
+// fakeClamd answers clamd commands on a unix socket until the listener is
+// closed.
+func fakeClamd(t *testing.T, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		reader := bufio.NewReader(conn)
+		cmd, _ := reader.ReadString(0)
+		switch cmd {
+		case "zPING\x00":
+			conn.Write([]byte("PONG\x00"))
+		case "zINSTREAM\x00":
+			var data []byte
+			size := make([]byte, 4)
+			for {
+				if _, err := io.ReadFull(reader, size); err != nil {
+					t.Errorf("Error reading chunk size: %v", err)
+					break
+				}
+				n := binary.BigEndian.Uint32(size)
+				if n == 0 {
+					break
+				}
+				chunk := make([]byte, n)
+				if _, err := io.ReadFull(reader, chunk); err != nil {
+					t.Errorf("Error reading chunk: %v", err)
+					break
+				}
+				data = append(data, chunk...)
+				if len(data) > fakeClamdStreamMaxLength {
+					break
+				}
+			}
+			if len(data) > fakeClamdStreamMaxLength {
+				conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			} else if bytes.Contains(data, []byte("EICAR")) {
+				conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+			} else {
+				conn.Write([]byte("stream: OK\x00"))
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestClamdScanner(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_clamd")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	socket := filepath.Join(tmpDir, "clamd.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets not available: %v", err)
+	}
+	defer listener.Close()
+	go fakeClamd(t, listener)
+
+	if err := checkClamd(socket); err != nil {
+		t.Fatalf("Unexpected ping error: %v", err)
+	}
+
+	scanner := newClamdScanner(socket)
+	clean := filepath.Join(tmpDir, "clean.pdf")
+	infected := filepath.Join(tmpDir, "infected.pdf")
+	// larger than one chunk to test streaming
+	cleanData := bytes.Repeat([]byte("x"), clamdChunkSize+10)
+	if err := ioutil.WriteFile(clean, cleanData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(infected, append(cleanData, []byte("EICAR")...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scanFile := func(path string) (scanResult, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		return scanner.Scan(file)
+	}
+	if result, err := scanFile(clean); err != nil || result.Infected {
+		t.Fatalf("Unexpected result for clean file: %+v, %v", result, err)
+	}
+	result, err := scanFile(infected)
+	if err != nil || !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("Unexpected result for infected file: %+v, %v", result, err)
+	}
+
+	// clamd closes the connection after replying to streams exceeding its
+	// size limit
+	large := filepath.Join(tmpDir, "large.mp4")
+	if err := ioutil.WriteFile(large, bytes.Repeat([]byte("x"), 64*clamdChunkSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanFile(large); err != errScanSizeLimit {
+		t.Fatalf("Expected size limit error, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// certReloader holds the TLS certificate used by the server and allows
+// replacing it at runtime, e.g. after a certificate renewal.
+type certReloader struct {
+	sync.RWMutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+}
+
+// newCertReloader loads the certificate and key from the provided files
+// and returns a certReloader serving them.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload reads the certificate and key files again and replaces the
+// currently served certificate. The previous certificate is kept if
+// loading fails.
+func (cr *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.Lock()
+	cr.cert = &cert
+	cr.Unlock()
+	return nil
+}
+
+// GetCertificate implements the tls.Config GetCertificate callback.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.RLock()
+	defer cr.RUnlock()
+	return cr.cert, nil
+}
+
+// listenAddress returns the TCP address the server should bind to.
+func listenAddress(cfg *Config) string {
+	return net.JoinHostPort(cfg.ListenAddress, fmt.Sprint(cfg.Port))
+}
+
+// tlsEnabled returns true if both a certificate and a key file are configured.
+func tlsEnabled(cfg *Config) bool {
+	return cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+}
+
+// socketMode returns the configured permissions of the Unix socket, or 0
+// if the permissions are left to the umask.
+func socketMode(cfg *Config) (os.FileMode, error) {
+	if cfg.UnixSocketMode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(cfg.UnixSocketMode, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("%q is not an octal file mode such as 0660", cfg.UnixSocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// listen creates the listener for the server. If a Unix socket is
+// configured, it takes precedence over the TCP address and a stale
+// socket from a previous run is removed first. Any other file at the
+// socket path is left alone and reported as an error.
+func listen(cfg *Config) (net.Listener, error) {
+	if cfg.UnixSocket != "" {
+		if info, err := os.Lstat(cfg.UnixSocket); err == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("%s exists and is not a socket", cfg.UnixSocket)
+			}
+			if err := os.Remove(cfg.UnixSocket); err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		mode, err := socketMode(cfg)
+		if err != nil {
+			return nil, err
+		}
+		listener, err := net.Listen("unix", cfg.UnixSocket)
+		if err != nil {
+			return nil, err
+		}
+		if mode != 0 {
+			if err := os.Chmod(cfg.UnixSocket, mode); err != nil {
+				listener.Close()
+				return nil, err
+			}
+		}
+		return listener, nil
+	}
+	return net.Listen("tcp", listenAddress(cfg))
+}
+
+// Start opens the configured listener and starts serving in a goroutine.
+// Unlike web.Server.Start, it returns an error if the listener cannot be
+// created, e.g. because the port is already in use.
+func (uploader *Uploader) Start() error {
+	cfg := uploader.Config()
+	listener, err := listen(cfg)
+	if err != nil {
+		return err
+	}
+
+	if tlsEnabled(cfg) {
+		reloader, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		uploader.certs = reloader
+		uploader.Web.Server.TLSConfig = &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+		listener = tls.NewListener(listener, uploader.Web.Server.TLSConfig)
+	}
+
+	if uploader.publisher != nil {
+		go uploader.publisher.Run()
+	}
+	if uploader.transcoder != nil {
+		uploader.transcoder.Start()
+	}
+	go func() {
+		if err := uploader.Web.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Println(err)
+		}
+	}()
+	return nil
+}
+
+// listenDescription returns a human readable description of where the
+// server is listening for log messages.
+func listenDescription(cfg *Config) string {
+	scheme := "http"
+	if tlsEnabled(cfg) {
+		scheme = "https"
+	}
+	if cfg.UnixSocket != "" {
+		return fmt.Sprintf("%s on unix socket %s", scheme, cfg.UnixSocket)
+	}
+	return fmt.Sprintf("%s on %s", scheme, listenAddress(cfg))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenAddress(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Port = 8080
+	if addr := listenAddress(cfg); addr != ":8080" {
+		t.Fatalf("Unexpected listen address: %q", addr)
+	}
+	cfg.ListenAddress = "127.0.0.1"
+	if addr := listenAddress(cfg); addr != "127.0.0.1:8080" {
+		t.Fatalf("Unexpected listen address: %q", addr)
+	}
+	cfg.ListenAddress = "::1"
+	if addr := listenAddress(cfg); addr != "[::1]:8080" {
+		t.Fatalf("Unexpected listen address: %q", addr)
+	}
+}
+
+func TestStartUnixSocket(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_socket")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := defaultConfig()
+	cfg.UploadDirectory = tmpDir
+	cfg.UnixSocket = filepath.Join(tmpDir, "uploader.sock")
+	cfg.UnixSocketMode = "0660"
+	// stale socket from a previous run must not prevent startup
+	stale, err := net.Listen("unix", cfg.UnixSocket)
+	if err != nil {
+		t.Fatalf("Error creating stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	uploader := NewUploader(cfg)
+	if err := uploader.Start(); err != nil {
+		t.Fatalf("Error starting server: %v", err)
+	}
+	defer uploader.Web.Stop()
+	if info, err := os.Stat(cfg.UnixSocket); err != nil || info.Mode().Perm() != 0660 {
+		t.Fatalf("Unexpected socket permissions %v: %v", info.Mode(), err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return new(net.Dialer).DialContext(ctx, "unix", cfg.UnixSocket)
+			},
+		},
+	}
+	resp, err := client.Get("http://uploader/uploads/")
+	if err != nil {
+		t.Fatalf("Error requesting via unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+func TestListenUnixSocketNoSocket(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_socket")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// a file which is not a socket is never removed
+	cfg := defaultConfig()
+	cfg.UnixSocket = filepath.Join(tmpDir, "uploader.sock")
+	if err := writeTmpFile(cfg.UnixSocket); err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+	if listener, err := listen(cfg); err == nil {
+		listener.Close()
+		t.Fatal("Expected error listening on a regular file")
+	}
+	if _, err := os.Stat(cfg.UnixSocket); err != nil {
+		t.Fatalf("File at socket path removed: %v", err)
+	}
+}
+
+func TestSocketMode(t *testing.T) {
+	cfg := defaultConfig()
+	for value, expected := range map[string]os.FileMode{"": 0, "0660": 0660, "600": 0600} {
+		cfg.UnixSocketMode = value
+		if mode, err := socketMode(cfg); err != nil || mode != expected {
+			t.Fatalf("Unexpected mode %v for %q: %v", mode, value, err)
+		}
+	}
+	for _, value := range []string{"0", "rw", "0999", "01777"} {
+		cfg.UnixSocketMode = value
+		if _, err := socketMode(cfg); err == nil {
+			t.Fatalf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestCertReloaderMissingFiles(t *testing.T) {
+	if _, err := newCertReloader("nonexistent.crt", "nonexistent.key"); err == nil {
+		t.Fatal("Expected error loading nonexistent certificate")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// uploadURL returns the URL the uploaded file is served at.
+func uploadURL(name string) string {
+	return "/uploads/" + url.PathEscape(name)
+}
+
+// URL returns the URL the stored file is served at.
+func (sf *storedFile) URL() string {
+	return uploadURL(sf.Name)
+}
+
+// submissionVersions returns the older versions of all files of the
+// current submission.
+func submissionVersions(cfg *Config, current *submissionResult) ([]fileVersion, error) {
+	store := newStorage(cfg)
+	names := []string{current.ID + ".pdf", current.ID + ".url"}
+	if current.Video != nil {
+		names = append(names, current.Video.Name)
+	}
+	versions := make([]fileVersion, 0)
+	for _, name := range names {
+		fileVersions, err := listVersions(store, name)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, fileVersions...)
+	}
+	return versions, nil
+}
+
+// statusForm renders the form for presenters to enter their upload key
+// and check their current submission.
+func (uploader *Uploader) statusForm(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	data := cfg.templateData(w, r)
+	tmpl, err := uploader.templates.lookup(statusFormPage)
+	if err != nil {
+		log.Printf("Error rendering status form: %v", err)
+		uploader.templates.failure(w, http.StatusInternalServerError, data, "error.formdisplay")
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Error rendering status form: %v", err)
+	}
+}
+
+// status shows the poster metadata and the currently stored files and
+// versions of the presenter identified by the upload key.
+func (uploader *Uploader) status(w http.ResponseWriter, r *http.Request) {
+	cfg := uploader.Config()
+	data := cfg.templateData(w, r)
+
+	user, serr := uploader.authenticate(r.PostFormValue("passcode"))
+	if serr != nil {
+		uploader.templates.failure(w, serr.Status, data, serr.Message, serr.Args...)
+		return
+	}
+
+	current, err := currentSubmission(cfg, user)
+	if err != nil {
+		log.Printf("ERROR reading submission of %q: %v", user.ID, err)
+		uploader.templates.failure(w, http.StatusInternalServerError, data, "error.internal")
+		return
+	}
+	versions, err := submissionVersions(cfg, current)
+	if err != nil {
+		log.Printf("ERROR reading versions of %q: %v", user.ID, err)
+		uploader.templates.failure(w, http.StatusInternalServerError, data, "error.internal")
+		return
+	}
+
+	tmpl, err := uploader.templates.lookup(statusPage)
+	if err != nil {
+		log.Printf("Error rendering status page: %v", err)
+		uploader.templates.failure(w, http.StatusInternalServerError, data, "error.formdisplay")
+		return
+	}
+	data["UserData"] = user
+	data["Submission"] = current
+	data["Versions"] = versions
+	if uploader.transcoder != nil {
+		data["Transcode"] = uploader.transcoder.Status(user.ID)
+	}
+	// the upload key is required for the actions on the status page
+	data["Passcode"] = r.PostFormValue("passcode")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Error rendering status page: %v", err)
+	}
+}
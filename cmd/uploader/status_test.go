@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListVersions(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+
+	store := newStorage(cfg)
+	for _, content := range []string{"first", "second", "third"} {
+		if err := rotateVersions(cfg, store, "id.pdf"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save("id.pdf", strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// numbered versions of older uploads are listed after the others
+	if err := writeTmpFile(filepath.Join(cfg.UploadDirectory, "id-v1.pdf")); err != nil {
+		t.Fatalf("Error creating test file: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(cfg.UploadDirectory, "id-v1.pdf"), old, old)
+	// files of other posters with a common prefix are not versions
+	if err := writeTmpFile(filepath.Join(cfg.UploadDirectory, "id-v1-v1.pdf")); err != nil {
+		t.Fatalf("Error creating test file: %v", err)
+	}
+
+	versions, err := listVersions(store, "id.pdf")
+	if err != nil {
+		t.Fatalf("Error listing versions: %v", err)
+	}
+	// versions are named after their hash, which is not computed again
+	if len(versions) != 3 || !strings.HasSuffix(versions[0].Version, "-"+sha1String("second")[:8]) ||
+		!strings.HasSuffix(versions[1].Version, "-"+sha1String("first")[:8]) || versions[2].Version != "1" {
+		t.Fatalf("Unexpected versions: %+v", versions)
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+
+	for _, content := range []string{"%PDF-1.4 first", "%PDF-1.4 second"} {
+		files := map[string][2]string{"poster": {"poster.pdf", content}}
+		fields := map[string]string{"passcode": "key", "video_url": "https://example.com/" + content[9:]}
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, newSubmissionRequest(t, "/submit", fields, files))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Submission failed with status %d", w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code for status form: %d", w.Code)
+	}
+
+	form := url.Values{"passcode": {"wrong"}}
+	req := httptest.NewRequest("POST", "/status", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected unauthorised status, got %d", w.Code)
+	}
+
+	form = url.Values{"passcode": {"key"}}
+	req = httptest.NewRequest("POST", "/status", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code for status page: %d", w.Code)
+	}
+	res := w.Body.String()
+	contentCheck := []string{
+		"Title", "Author",
+		// the hash of the current file and the version named after its hash
+		sha1String("%PDF-1.4 second"), "-" + sha1String("%PDF-1.4 first")[:8] + ".pdf",
+		"https://example.com/second", "https://example.com/first",
+		"/uploads/id.pdf", "/uploads/id-v", "-" + sha1String("https://example.com/first")[:8] + ".url",
+	}
+	for _, item := range contentCheck {
+		if !strings.Contains(res, item) {
+			t.Fatalf("Status page is missing %q", item)
+		}
+	}
+}
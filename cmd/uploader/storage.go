@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Storage backends
+const (
+	storageFilesystem = "filesystem"
+	storageS3         = "s3"
+)
+
+// readSeekCloser is the content of a stored file.
+type readSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// storage stores uploaded files by name. Names may contain slashes to
+// store files in directories. Errors for missing files satisfy
+// os.IsNotExist.
+type storage interface {
+	// Save stores the content from its start under name, replacing an
+	// existing file.
+	Save(name string, content io.ReadSeeker) error
+	// Rename moves a file, replacing an existing file.
+	Rename(from, to string) error
+	// List returns the names of all files starting with prefix, sorted.
+	List(prefix string) ([]string, error)
+	// Stat returns name, size and modification time of a file. SHA1 is
+	// only set if the backend stores it.
+	Stat(name string) (*storedFile, error)
+	Open(name string) (readSeekCloser, error)
+	Delete(name string) error
+}
+
+// sizeLister is implemented by backends which return the file sizes with
+// the listing, so measuring the usage does not need a Stat per file.
+type sizeLister interface {
+	// ListSizes returns the sizes of all files starting with prefix by name.
+	ListSizes(prefix string) (map[string]int64, error)
+}
+
+// listSizes returns the sizes of all files starting with prefix. Files
+// deleted while listing are skipped.
+func listSizes(store storage, prefix string) (map[string]int64, error) {
+	if lister, ok := store.(sizeLister); ok {
+		return lister.ListSizes(prefix)
+	}
+	names, err := store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(names))
+	for _, name := range names {
+		stored, err := store.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sizes[name] = stored.Size
+	}
+	return sizes, nil
+}
+
+// localStorage is implemented by backends storing files on the local file
+// system, which external commands can access directly.
+type localStorage interface {
+	LocalPath(name string) string
+	// LocalRoot is the directory containing all files
+	LocalRoot() string
+}
+
+// newStorage returns the storage of the configuration with the configured
+// layout. It is replaced in tests.
+var newStorage = func(cfg *Config) storage {
+	return withLayout(cfg.StorageLayout, newBackend(cfg))
+}
+
+// newBackend returns the storage backend of the configuration, which
+// stores files under their physical names.
+func newBackend(cfg *Config) storage {
+	if cfg.Storage == storageS3 {
+		return newS3Storage(cfg)
+	}
+	return fsStorage{dir: cfg.UploadDirectory}
+}
+
+// fsStorage stores files in a directory.
+type fsStorage struct {
+	dir string
+}
+
+// Save writes the content to a temporary file first, so incomplete files
+// are never served.
+func (fs fsStorage) Save(name string, content io.ReadSeeker) error {
+	dir := filepath.Dir(fs.LocalPath(name))
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	tmpname, err := createTempFile(dir, ".save-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpname)
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := saveFile(content, tmpname); err != nil {
+		return err
+	}
+	return os.Rename(tmpname, fs.LocalPath(name))
+}
+
+// createTempFile creates an empty file with a new name starting with prefix
+// in dir and returns its path. Unlike ioutil.TempFile, which creates files
+// readable only by the owner, the file is created with the same permissions
+// as os.Create, so stored files stay readable by the web server.
+func createTempFile(dir, prefix string) (string, error) {
+	for try := 0; try < 10000; try++ {
+		path := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Int63()), 36))
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		return path, file.Close()
+	}
+	return "", fmt.Errorf("no unused temporary file name in %s", dir)
+}
+
+func (fs fsStorage) Rename(from, to string) error {
+	target := fs.LocalPath(to)
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return err
+	}
+	if err := os.Rename(fs.LocalPath(from), target); err != nil {
+		return err
+	}
+	pruneEmptyDirs(filepath.Dir(fs.LocalPath(from)), fs.dir)
+	return nil
+}
+
+// walk calls fn for all files starting with prefix in name order, skipping
+// directories which cannot contain such names.
+func (fs fsStorage) walk(prefix string, fn func(name string, info os.FileInfo)) error {
+	return filepath.Walk(fs.dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path != fs.dir {
+			// deleted while walking
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(fs.dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		// hidden files are incomplete uploads
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if !strings.HasPrefix(name+"/", prefix) && !strings.HasPrefix(prefix, name+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, prefix) {
+			fn(name, info)
+		}
+		return nil
+	})
+}
+
+func (fs fsStorage) List(prefix string) ([]string, error) {
+	names := make([]string, 0)
+	err := fs.walk(prefix, func(name string, info os.FileInfo) {
+		names = append(names, name)
+	})
+	return names, err
+}
+
+func (fs fsStorage) ListSizes(prefix string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	err := fs.walk(prefix, func(name string, info os.FileInfo) {
+		sizes[name] = info.Size()
+	})
+	return sizes, err
+}
+
+func (fs fsStorage) Stat(name string) (*storedFile, error) {
+	info, err := os.Stat(fs.LocalPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return &storedFile{Name: name, Size: info.Size(), Modified: info.ModTime()}, nil
+}
+
+func (fs fsStorage) Open(name string) (readSeekCloser, error) {
+	return os.Open(fs.LocalPath(name))
+}
+
+func (fs fsStorage) Delete(name string) error {
+	if err := os.Remove(fs.LocalPath(name)); err != nil {
+		return err
+	}
+	pruneEmptyDirs(filepath.Dir(fs.LocalPath(name)), fs.dir)
+	return nil
+}
+
+func (fs fsStorage) LocalPath(name string) string {
+	return filepath.Join(fs.dir, filepath.FromSlash(name))
+}
+
+func (fs fsStorage) LocalRoot() string {
+	return fs.dir
+}
+
+// pruneEmptyDirs removes dir and its parents up to root as long as they
+// are empty.
+func pruneEmptyDirs(dir, root string) {
+	for isSubdir(root, dir) && !isSubdir(dir, root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// statStored returns the description of a stored file including its hash,
+// which is computed if the backend does not store it.
+func statStored(store storage, name string) (*storedFile, error) {
+	stored, err := store.Stat(name)
+	if err != nil || stored.SHA1 != "" {
+		return stored, err
+	}
+	content, err := store.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	if stored.SHA1, err = sha1Reader(content); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// readStored returns the content of a small stored file.
+func readStored(store storage, name string) (string, error) {
+	content, err := store.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	data, err := ioutil.ReadAll(content)
+	return string(data), err
+}
+
+// localFile returns a local path of a stored file for external commands.
+// Files of remote backends are copied to a temporary file which is
+// removed by the returned function.
+func localFile(store storage, name string) (string, func(), error) {
+	if local, ok := store.(localStorage); ok {
+		path := local.LocalPath(name)
+		if _, err := os.Stat(path); err != nil {
+			return "", nil, err
+		}
+		return path, func() {}, nil
+	}
+	content, err := store.Open(name)
+	if err != nil {
+		return "", nil, err
+	}
+	defer content.Close()
+	tmpfile, err := ioutil.TempFile("", "uploader-*"+filepath.Ext(name))
+	if err != nil {
+		return "", nil, err
+	}
+	defer tmpfile.Close()
+	cleanup := func() { os.Remove(tmpfile.Name()) }
+	if _, err := io.Copy(tmpfile, content); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tmpfile.Name(), cleanup, nil
+}
+
+// moveToLocal moves a stored file to a local directory.
+func moveToLocal(store storage, name, dir string) (string, error) {
+	path, cleanup, err := localFile(store, name)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	target := filepath.Join(dir, name)
+	if local, ok := store.(localStorage); ok {
+		if err := os.Rename(path, target); err != nil {
+			return "", err
+		}
+		pruneEmptyDirs(filepath.Dir(path), local.LocalRoot())
+		return target, nil
+	}
+	// copies of remote files are on the local temporary file system which
+	// may be a different device
+	source, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	if err := saveFile(source, target); err != nil {
+		return "", err
+	}
+	return target, store.Delete(name)
+}
+
+// serveUpload serves stored files under /uploads/ and lists all stored
+// files at /uploads/ like a file server directory listing.
+func (uploader *Uploader) serveUpload(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/uploads/")
+	store := newStorage(uploader.Config())
+	if name == "" {
+		listUploads(w, store)
+		return
+	}
+	if !publicUpload(name) || strings.ContainsAny(name, `/\`) {
+		http.NotFound(w, r)
+		return
+	}
+	stored, err := store.Stat(name)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Printf("ERROR serving %q: %v", name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	content, err := store.Open(name)
+	if err != nil {
+		log.Printf("ERROR serving %q: %v", name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+	if stored.SHA1 != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", stored.SHA1))
+	}
+	http.ServeContent(w, r, name, stored.Modified, content)
+}
+
+// publicUpload returns false for stored files which are not served under
+// /uploads/: hidden files such as incomplete uploads and the PDF check
+// results, which are only shown to admins.
+func publicUpload(name string) bool {
+	return !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, checkSuffix)
+}
+
+// listUploads writes an HTML list of links to all stored files in the
+// format of http.FileServer. Files which are not served are left out.
+func listUploads(w http.ResponseWriter, store storage) {
+	names, err := store.List("")
+	if err != nil {
+		log.Printf("ERROR listing uploads: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sort.Strings(names)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, name := range names {
+		if !publicUpload(name) {
+			continue
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
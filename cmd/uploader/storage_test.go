@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory S3 server supporting the requests used by
+// s3Storage. Listings return at most two keys per page.
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+	meta    map[string]string
+	// heads counts HEAD requests
+	heads int
+}
+
+func newFakeS3() *httptest.Server {
+	return httptest.NewServer(newFakeS3Handler())
+}
+
+func newFakeS3Handler() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), meta: make(map[string]string)}
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.Lock()
+	defer fake.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path == "/bucket" && r.Method == "GET" {
+		fake.list(w, r)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch r.Method {
+	case "PUT":
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			source, _ = url.PathUnescape(strings.TrimPrefix(source, "/bucket/"))
+			data, ok := fake.objects[source]
+			if !ok {
+				http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+				return
+			}
+			fake.objects[key] = data
+			fake.meta[key] = fake.meta[source]
+			w.Write([]byte("<CopyObjectResult></CopyObjectResult>"))
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		fake.objects[key] = data
+		fake.meta[key] = r.Header.Get("X-Amz-Meta-Sha1")
+	case "GET", "HEAD":
+		if r.Method == "HEAD" {
+			fake.heads++
+		}
+		data, ok := fake.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Amz-Meta-Sha1", fake.meta[key])
+		http.ServeContent(w, r, key, time.Now(), bytes.NewReader(data))
+	case "DELETE":
+		delete(fake.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (fake *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	keys := make([]string, 0)
+	for key := range fake.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	type content struct {
+		Key  string
+		Size int64
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool
+		NextContinuationToken string
+		Contents              []content
+	}{}
+	for idx, key := range keys {
+		if idx == 2 {
+			result.IsTruncated = true
+			result.NextContinuationToken = keys[1]
+			break
+		}
+		result.Contents = append(result.Contents, content{Key: key, Size: int64(len(fake.objects[key]))})
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3Storage(endpoint string) *s3Storage {
+	cfg := defaultConfig()
+	cfg.Storage = storageS3
+	cfg.S3Endpoint = endpoint
+	cfg.S3Bucket = "bucket"
+	cfg.S3AccessKey = "access"
+	cfg.S3SecretKey = "secret"
+	return newS3Storage(cfg)
+}
+
+func TestS3SigningKey(t *testing.T) {
+	// example from the AWS signature version 4 documentation
+	key := s3SigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	if hex.EncodeToString(key) != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Fatalf("Unexpected signing key %x", key)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := newFakeS3Handler()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	store := newTestS3Storage(server.URL)
+
+	if _, err := store.Stat("id.pdf"); !os.IsNotExist(err) {
+		t.Fatalf("Expected not exist error, got %v", err)
+	}
+	cfg := &Config{KeepVersions: 3}
+	for _, content := range []string{"first", "second", "third"} {
+		if err := rotateVersions(cfg, store, "id.pdf"); err != nil {
+			t.Fatalf("Error rotating versions: %v", err)
+		}
+		if err := store.Save("id.pdf", strings.NewReader(content)); err != nil {
+			t.Fatalf("Error saving file: %v", err)
+		}
+	}
+	if err := store.Save("other.pdf", strings.NewReader("other")); err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+
+	names, err := store.List("id")
+	if err != nil {
+		t.Fatalf("Error listing files: %v", err)
+	}
+	versions, err := listVersions(store, "id.pdf")
+	if err != nil || len(names) != 3 || len(versions) != 2 {
+		t.Fatalf("Unexpected files %v: %v", names, err)
+	}
+	first := versions[1].Name
+	if !strings.HasSuffix(first, "-"+sha1String("first")[:8]+".pdf") {
+		t.Fatalf("Unexpected oldest version %s", first)
+	}
+
+	stored, err := store.Stat("id.pdf")
+	if err != nil || stored.Size != 5 || stored.SHA1 != sha1String("third") {
+		t.Fatalf("Unexpected file info %+v: %v", stored, err)
+	}
+	if data, err := readStored(store, first); err != nil || data != "first" {
+		t.Fatalf("Unexpected version content %q: %v", data, err)
+	}
+
+	// reading after seeking requests the remaining range only
+	content, err := store.Open("id.pdf")
+	if err != nil {
+		t.Fatalf("Error opening file: %v", err)
+	}
+	content.Seek(2, 0)
+	data, _ := ioutil.ReadAll(content)
+	content.Close()
+	if string(data) != "ird" {
+		t.Fatalf("Unexpected content after seek %q", data)
+	}
+
+	// usage is measured from the listing without requesting each object
+	fake.Lock()
+	fake.heads = 0
+	fake.Unlock()
+	for _, layout := range []string{layoutFlat, layoutDirectories} {
+		usage, err := measureUsage(withLayout(layout, store), "")
+		if err != nil || usage.Total != 21 || usage.Files != 4 || usage.Posters["id"] != 16 {
+			t.Fatalf("Unexpected usage with %s layout %+v: %v", layout, usage, err)
+		}
+	}
+	if fake.heads != 0 {
+		t.Fatalf("Unexpected HEAD requests measuring usage: %d", fake.heads)
+	}
+
+	if err := store.Delete("other.pdf"); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if _, err := store.Stat("other.pdf"); !os.IsNotExist(err) {
+		t.Fatalf("File not deleted: %v", err)
+	}
+
+	store.secretKey = ""
+	store.accessKey = "wrong"
+	if _, err := store.List(""); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Fatalf("Expected access denied error, got %v", err)
+	}
+}
+
+func TestS3Submission(t *testing.T) {
+	server := newFakeS3()
+	defer server.Close()
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.Storage = storageS3
+	cfg.S3Endpoint = server.URL
+	cfg.S3Bucket = "bucket"
+	cfg.S3AccessKey = "access"
+	cfg.S3SecretKey = "secret"
+
+	files := map[string][2]string{"poster": {"poster.pdf", "%PDF-1.4 test"}}
+	req := newSubmissionRequest(t, "/api/v1/submissions", map[string]string{"video_url": "https://example.com/video"}, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status code %d: %s", w.Code, w.Body.String())
+	}
+	result := submissionResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if result.Poster == nil || result.Poster.SHA1 != sha1String("%PDF-1.4 test") || result.VideoURL != "https://example.com/video" {
+		t.Fatalf("Unexpected submission result: %s", w.Body.String())
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 0); err != nil {
+		t.Fatalf("Files written to upload directory: %v", err)
+	}
+
+	// uploads are served from the storage
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", "/uploads/id.pdf", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "%PDF-1.4 test" {
+		t.Fatalf("Unexpected upload response %d: %q", w.Code, w.Body.String())
+	}
+
+	// restoring an older version twice keeps the current file
+	cfg.KeepVersions = 0
+	files["poster"] = [2]string{"poster.pdf", "%PDF-1.4 new"}
+	req = newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+	req.Header.Set(uploadKeyHeader, "key")
+	uploader.Web.Router.ServeHTTP(httptest.NewRecorder(), req)
+	store := newStorage(cfg)
+	versions, err := listVersions(store, "id.pdf")
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("Unexpected versions %+v: %v", versions, err)
+	}
+	for idx := 0; idx < 2; idx++ {
+		if err := uploader.restoreVersion(cfg, "id", versions[0].Name, actorPresenter); err != nil {
+			t.Fatalf("Error restoring %s: %v", versions[0].Name, err)
+		}
+	}
+	if data, err := readStored(store, "id.pdf"); err != nil || data != "%PDF-1.4 test" {
+		t.Fatalf("Unexpected current file %q: %v", data, err)
+	}
+}
+
+func TestFSStorageFileMode(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_storage")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// stored files get the same permissions as files created with os.Create
+	if err := saveFile(strings.NewReader("reference"), filepath.Join(tmpDir, "reference")); err != nil {
+		t.Fatal(err)
+	}
+	reference, err := os.Stat(filepath.Join(tmpDir, "reference"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := fsStorage{dir: tmpDir}
+	if err := store.Save("id.pdf", strings.NewReader("%PDF-1.4 test")); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := os.Stat(filepath.Join(tmpDir, "id.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Mode().Perm() != reference.Mode().Perm() {
+		t.Fatalf("Unexpected mode %v of stored file, expected %v", stored.Mode(), reference.Mode())
+	}
+}
+
+func TestServeUpload(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	store := newStorage(uploader.Config())
+	if err := store.Save("id.pdf", strings.NewReader("%PDF-1.4 test")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(".hidden.pdf", strings.NewReader("hidden")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(checkName("id"), strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/uploads/id.pdf", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "%PDF" {
+		t.Fatalf("Unexpected range response %d: %q", w.Code, w.Body.String())
+	}
+
+	// the listing links all stored files except hidden ones and check results
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", "/uploads/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<a href="id.pdf">id.pdf</a>`) ||
+		strings.Contains(w.Body.String(), "hidden") || strings.Contains(w.Body.String(), checkSuffix) {
+		t.Fatalf("Unexpected listing %d: %q", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/uploads/.hidden.pdf", "/uploads/id-check.json", "/uploads/missing.pdf"} {
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Expected not found for %s, got %d", path, w.Code)
+		}
+	}
+	// the router redirects to the cleaned path
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", "/uploads/..%2fposters.json", nil))
+	if w.Code == http.StatusOK {
+		t.Fatalf("File outside the upload directory served: %q", w.Body.String())
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// submissionError describes a failed submission. Code is a machine
+// readable error code for API clients and Message the message key of the
+// error message displayed to the presenter.
+type submissionError struct {
+	Status  int
+	Code    string
+	Message string
+	Args    []interface{}
+}
+
+func newSubmissionError(status int, code, message string, args ...interface{}) *submissionError {
+	return &submissionError{Status: status, Code: code, Message: message, Args: args}
+}
+
+func (serr *submissionError) Error() string {
+	return fmt.Sprintf("%s: %s", serr.Code, tr(defaultLanguage, serr.Message, serr.Args...))
+}
+
+// apiError is the JSON representation of a submissionError.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// storedFile describes an uploaded file in the storage.
+type storedFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	SHA1     string    `json:"sha1"`
+	Modified time.Time `json:"modified"`
+}
+
+// Parts of a submission which can be updated individually.
+const (
+	partPoster   = "poster"
+	partVideo    = "video"
+	partVideoURL = "video_url"
+)
+
+// submissionResult describes the files stored for a poster. Changed lists
+// the parts updated by a submission and Unchanged the submitted parts
+// identical to the current files; all other parts were kept.
+type submissionResult struct {
+	ID       string      `json:"id"`
+	Poster   *storedFile `json:"poster,omitempty"`
+	Video    *storedFile `json:"video,omitempty"`
+	VideoURL string      `json:"video_url,omitempty"`
+	// Thumbnail and Preview are PNG images of the first poster page
+	Thumbnail *storedFile `json:"thumbnail,omitempty"`
+	Preview   *storedFile `json:"preview,omitempty"`
+	// Check is the comparison of the uploaded poster PDF with the poster
+	Check *pdfCheck `json:"pdf_check,omitempty"`
+	// VideoInfo describes the uploaded video if videos are probed
+	VideoInfo *videoInfo `json:"video_info,omitempty"`
+	Changed   []string   `json:"changed,omitempty"`
+	Unchanged []string   `json:"unchanged,omitempty"`
+}
+
+// submissionPart describes the state of a part of a submission.
+type submissionPart struct {
+	Name      string
+	Present   bool
+	Changed   bool
+	Unchanged bool
+}
+
+// wantsJSON returns true if the client prefers a JSON response over HTML.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// respondSubmissionError renders the failure page or returns a JSON
+// error, depending on the type of response the client accepts.
+func (uploader *Uploader) respondSubmissionError(w http.ResponseWriter, r *http.Request, data map[string]interface{}, serr *submissionError) {
+	if wantsJSON(r) {
+		lang, _ := data["lang"].(string)
+		msg := apiError{Code: serr.Code, Message: string(tr(lang, serr.Message, serr.Args...))}
+		writeJSON(w, serr.Status, msg)
+		return
+	}
+	uploader.templates.failure(w, serr.Status, data, serr.Message, serr.Args...)
+}
+
+// upload is a file uploaded with a submission.
+type upload struct {
+	// name is the file name provided by the client
+	name    string
+	content multipart.File
+	size    int64
+	// target is the storage name of the file
+	target string
+}
+
+// unchangedUpload returns the current file if the upload is identical to
+// it, so repeated submissions of the same file do not rotate versions.
+func unchangedUpload(store storage, upload *upload) *storedFile {
+	current, err := statStored(store, upload.target)
+	if err != nil {
+		return nil
+	}
+	hash, err := sha1Reader(upload.content)
+	if _, serr := upload.content.Seek(0, io.SeekStart); err != nil || serr != nil || hash != current.SHA1 {
+		return nil
+	}
+	log.Printf("Upload %q identical to %s, no change detected", upload.name, upload.target)
+	return current
+}
+
+// saveSubmission stores the poster, video and video URL of a submission
+// request for the provided poster. Uploaded files are scanned for malware
+// before any of the current files are replaced; files identical to the
+// current ones are not stored again.
+func (uploader *Uploader) saveSubmission(cfg *Config, r *http.Request, user *BCPoster) (*submissionResult, *submissionError) {
+	if !cfg.submissionOpen() {
+		log.Printf("Refusing submission for %q after the closing date", user.ID)
+		return nil, newSubmissionError(http.StatusForbidden, "submission_closed", "error.submissionclosed")
+	}
+	fileBasename := user.ID
+	store := newStorage(cfg)
+	save := func(upload *upload) (*storedFile, *submissionError) {
+		log.Printf("Writing file %q", upload.target)
+		ext := filepath.Ext(upload.target)
+		if err := rotateVersions(cfg, store, upload.target); err != nil {
+			log.Printf("ERROR: %v", err.Error())
+			return nil, newSubmissionError(http.StatusInternalServerError, "storage_error", "error.fileupload", ext)
+		}
+		if err := store.Save(upload.target, upload.content); err != nil {
+			log.Printf("ERROR: %v", err.Error())
+			return nil, newSubmissionError(http.StatusInternalServerError, "storage_error", "error.fileupload", ext)
+		}
+		stored, err := statStored(store, upload.target)
+		if err != nil {
+			log.Printf("Failed to hash file upload %q: %s", upload.target, err.Error())
+			return &storedFile{Name: upload.target}, nil
+		}
+		return stored, nil
+	}
+
+	// openUpload returns the uploaded file of a form field or nil if the
+	// field is empty; poster, video and video URL are optional individually.
+	// Posters are always stored as .pdf and videos with the lower case
+	// extension of the uploaded file.
+	openUpload := func(field, message string) (*upload, *submissionError) {
+		file, header, err := r.FormFile(field)
+		if err == http.ErrMissingFile {
+			log.Printf("No %s provided", field)
+			return nil, nil
+		} else if err != nil {
+			log.Printf("ERROR: %v", err.Error())
+			return nil, newSubmissionError(http.StatusInternalServerError, field+"_upload_failed", message)
+		}
+		ext := ".pdf"
+		if field == partVideo {
+			ext = strings.ToLower(filepath.Ext(header.Filename))
+		}
+		return &upload{name: header.Filename, content: file, size: header.Size, target: fileBasename + ext}, nil
+	}
+
+	uploads := make([]*upload, 0, 2)
+	defer func() {
+		for _, upload := range uploads {
+			upload.content.Close()
+		}
+	}()
+	posterUpload, serr := openUpload("poster", "error.posterupload")
+	if serr != nil {
+		return nil, serr
+	}
+	if posterUpload != nil {
+		uploads = append(uploads, posterUpload)
+	}
+	var videoUpload *upload
+	if cfg.Videos {
+		if videoUpload, serr = openUpload("video", "error.videoupload"); serr != nil {
+			return nil, serr
+		}
+		if videoUpload != nil {
+			uploads = append(uploads, videoUpload)
+			if serr := checkVideoUpload(cfg, user, videoUpload); serr != nil {
+				log.Printf("Video %q uploaded for %q refused: %v", videoUpload.name, user.ID, serr)
+				return nil, serr
+			}
+		}
+	}
+	videoURL := r.PostForm.Get("video_url")
+	if len(uploads) == 0 && videoURL == "" {
+		log.Print("ERROR: empty submission")
+		return nil, newSubmissionError(http.StatusBadRequest, "empty_submission", "error.emptysubmission")
+	}
+	// the quota and the current files are checked under the same lock as
+	// the files are replaced
+	defer lockPoster(user.ID)()
+	// parts identical to the current files are not stored again, so they
+	// do not count towards the quota
+	unchanged := make(map[*upload]bool)
+	size := int64(0)
+	for _, upload := range uploads {
+		if unchangedUpload(store, upload) != nil {
+			unchanged[upload] = true
+		} else {
+			size += upload.size
+		}
+	}
+	fname := fmt.Sprintf("%s.url", fileBasename)
+	unchangedURL := false
+	if current, err := readStored(store, fname); err == nil && videoURL != "" && current == videoURL {
+		log.Printf("Video URL identical to %s, no change detected", fname)
+		unchangedURL = true
+	} else {
+		size += int64(len(videoURL))
+	}
+	if serr := checkQuota(cfg, store, user.ID, size); serr != nil {
+		return nil, serr
+	}
+	if serr := scanUploads(cfg, user.ID, uploads); serr != nil {
+		return nil, serr
+	}
+	var videoInfo *videoInfo
+	if videoUpload != nil {
+		if videoInfo, serr = probeUpload(cfg, uploader.proberFor(cfg), user.ID, videoUpload); serr != nil {
+			return nil, serr
+		}
+	}
+
+	result := &submissionResult{ID: user.ID, Changed: make([]string, 0, 3)}
+
+	// Save poster pdf
+	if unchanged[posterUpload] {
+		result.Unchanged = append(result.Unchanged, partPoster)
+	} else if posterUpload != nil {
+		poster, serr := save(posterUpload)
+		if serr != nil {
+			return nil, serr
+		}
+		result.Poster = poster
+		result.Changed = append(result.Changed, partPoster)
+		log.Printf("PDF file saved: %s (%s)", poster.Name, poster.SHA1)
+		if err := renderPreviews(cfg, uploader.rendererFor(cfg), user.ID); err != nil {
+			log.Printf("Failed to render previews of %q: %v", user.ID, err)
+		}
+		var err error
+		if result.Check, err = storePosterCheck(cfg, uploader.extractorFor(cfg), user); err != nil {
+			log.Printf("Failed to check PDF of %q: %v", user.ID, err)
+		}
+	}
+
+	// Save video file
+	if unchanged[videoUpload] {
+		result.Unchanged = append(result.Unchanged, partVideo)
+	} else if videoUpload != nil {
+		video, serr := save(videoUpload)
+		if serr != nil {
+			return nil, serr
+		}
+		result.Video = video
+		result.VideoInfo = videoInfo
+		result.Changed = append(result.Changed, partVideo)
+		log.Printf("Video file saved: %s", video.Name)
+	}
+
+	if unchangedURL {
+		result.Unchanged = append(result.Unchanged, partVideoURL)
+	} else if videoURL != "" {
+		err := rotateVersions(cfg, store, fname)
+		if err == nil {
+			err = store.Save(fname, strings.NewReader(videoURL))
+		}
+		if err != nil {
+			log.Printf("ERROR: %v", err.Error())
+			return nil, newSubmissionError(http.StatusInternalServerError, "storage_error", "error.formsubmission")
+		}
+		result.VideoURL = videoURL
+		result.Changed = append(result.Changed, partVideoURL)
+		log.Printf("URL file saved: %s (%s)", fname, videoURL)
+	}
+
+	// identical re-uploads leave the metadata unchanged
+	if len(result.Changed) > 0 {
+		if err := writeMetadata(cfg, uploader.templates.readme, user.ID); err != nil {
+			log.Printf("Failed to write metadata of %q: %v", user.ID, err)
+		}
+	}
+
+	// complete the result with the parts kept from earlier submissions
+	current, err := currentSubmission(cfg, user)
+	if err != nil {
+		log.Printf("Failed to read current submission of %q: %v", user.ID, err)
+		return result, nil
+	}
+	if result.Poster == nil {
+		result.Poster = current.Poster
+	}
+	if result.Video == nil {
+		result.Video = current.Video
+	}
+	if result.VideoURL == "" {
+		result.VideoURL = current.VideoURL
+	}
+	result.Thumbnail, result.Preview = current.Thumbnail, current.Preview
+	return result, nil
+}
+
+// containsPart returns true if the named part is in the list of parts.
+func containsPart(parts []string, part string) bool {
+	for _, p := range parts {
+		if p == part {
+			return true
+		}
+	}
+	return false
+}
+
+// changed returns true if the named part was changed by the submission.
+func (result *submissionResult) changed(part string) bool {
+	return containsPart(result.Changed, part)
+}
+
+// Parts returns the state of all parts of the submission for display on
+// the success page.
+func (result *submissionResult) Parts() []submissionPart {
+	parts := []submissionPart{
+		{Name: partPoster, Present: result.Poster != nil, Changed: result.changed(partPoster), Unchanged: containsPart(result.Unchanged, partPoster)},
+		{Name: partVideo, Present: result.Video != nil, Changed: result.changed(partVideo), Unchanged: containsPart(result.Unchanged, partVideo)},
+		{Name: partVideoURL, Present: result.VideoURL != "", Changed: result.changed(partVideoURL), Unchanged: containsPart(result.Unchanged, partVideoURL)},
+	}
+	return parts
+}
+
+// currentSubmission returns the files currently stored for a poster.
+func currentSubmission(cfg *Config, user *BCPoster) (*submissionResult, error) {
+	result := &submissionResult{ID: user.ID}
+	store := newStorage(cfg)
+	names, err := store.List(user.ID + ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if isVersion(name) || strings.Contains(strings.TrimPrefix(name, user.ID+"."), ".") {
+			continue
+		}
+		switch filepath.Ext(name) {
+		case ".url":
+			if result.VideoURL, err = readStored(store, name); err != nil {
+				return nil, err
+			}
+		case ".pdf":
+			if result.Poster, err = statStored(store, name); err != nil {
+				return nil, err
+			}
+		default:
+			if !cfg.isVideoName(name) {
+				continue
+			}
+			if result.Video, err = statStored(store, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if result.Thumbnail, result.Preview, err = currentPreviews(cfg, user.ID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
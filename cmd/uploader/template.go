@@ -1,11 +1,11 @@
 package main
 
 // Layout is the base Uploader template providing header and footer.
-// If required adjust the main poster gallery URL and the copyright
-// date before deploying for a new conference.
+// The conference name, poster gallery URL and footer content are set
+// in the configuration.
 const Layout = `
 {{ define "layout" }}
-<html>
+<html lang="{{ .lang }}">
 	<!DOCTYPE html>
 	<head data-suburl="">
 		<link rel="shortcut icon" href="/assets/favicon.png" />
@@ -14,11 +14,11 @@ const Layout = `
 		<link rel="stylesheet" href="/assets/semantic-2.3.1.min.css">
 		<link rel="stylesheet" href="/assets/gogs.css">
 		<link rel="stylesheet" href="/assets/custom.css">
-		<title>Bernstein Conference Poster Submission</title>
+		<title>{{ tr .lang "layout.title" .conferencename }}</title>
 		<meta name="twitter:card" content="summary" />
-		<meta name="twitter:site" content="@nncn_germany" />
-		<meta name="twitter:title" content="Bernstein Conference Poster Submission"/>
-		<meta name="twitter:description" content="Bernstein Conference Poster Submission"/>
+		{{ if .twittersite }}<meta name="twitter:site" content="{{ .twittersite }}" />{{ end }}
+		<meta name="twitter:title" content="{{ tr .lang "layout.title" .conferencename }}"/>
+		<meta name="twitter:description" content="{{ tr .lang "layout.title" .conferencename }}"/>
 		<meta name="twitter:image" content="/assets/favicon.png" />
 	</head>
 	<body>
@@ -28,11 +28,20 @@ const Layout = `
 					<div class="ui grid">
 						<div class="column">
 							<div class="ui top secondary menu">
-								<a class="item brand" href="https://posters.bc.g-node.org">
+								<a class="item brand" href="{{ .galleryurl }}">
 									<img class="ui mini image" src="/assets/favicon.png">
-									<a class="item" href="{{ .conferencepageurl }}">Conference Website</a>
-									<a class="item" href="mailto:{{ .supportemail }}">Contact</a>
+									<a class="item" href="{{ .conferencepageurl }}">{{ tr .lang "layout.conferencewebsite" }}</a>
+									<a class="item" href="mailto:{{ .supportemail }}">{{ tr .lang "layout.contact" }}</a>
 								</a>
+								<div class="right menu" aria-label="{{ tr .lang "layout.language" }}">
+									{{ range .languages }}
+									{{ if .Active }}
+									<span class="item active" lang="{{ .Lang }}">{{ .Name }}</span>
+									{{ else }}
+									<a class="item" href="{{ .URL }}" lang="{{ .Lang }}" hreflang="{{ .Lang }}">{{ .Name }}</a>
+									{{ end }}
+									{{ end }}
+								</div>
 							</div>
 						</div>
 					</div>
@@ -43,14 +52,15 @@ const Layout = `
 		<footer>
 			<div class="ui container">
 				<div class="ui center links item brand footertext">
-					<a href="http://www.g-node.org">
-						<img class="ui mini footericon" 
-							 src="https://projects.g-node.org/assets/gnode-bootstrap-theme/1.2.0-snapshot/img/gnode-icon-50x50-transparent.png"/>
-						© 2020-2022 G-Node
+					<a href="{{ .copyrightholderurl }}">
+						{{ if .copyrightholderlogo }}
+						<img class="ui mini footericon" src="{{ .copyrightholderlogo }}"/>
+						{{ end }}
+						© {{ .copyrightyear }} {{ .copyrightholder }}
 					</a>
-					<a href="https://bc.g-node.org/G-Node/Info/wiki/Terms+of+Use">Terms of Use</a>
-					<a href="https://bc.g-node.org/G-Node/Info/wiki/Datenschutz">Datenschutz</a>
-					<a href="https://bc.g-node.org/G-Node/Info/wiki/imprint">Imprint</a>
+					{{ range .footerlinks }}
+					<a href="{{ .URL }}">{{ linkname $.lang . }}</a>
+					{{ end }}
 				</div>
 			</div>
 		</footer>
@@ -79,10 +89,9 @@ const Form = `
 					<div class="column">
 						<form class="ui form" enctype="multipart/form-data" action="/submit" method="post">
 							<input type="hidden" name="_csrf" value="">
-							<p>Please upload your PDF and video URL by <strong>{{ .closedtext }}</strong> using the form below.
-							You have received an upload key in the instruction email.</p>
-							<p>You can access the form and re-upload your poster and URL until the deadline.</p>
-							<p><strong>Please note: posters sent via email will not be considered.</strong></p>
+							<p>{{ tr .lang "form.intro" .closedtext }}</p>
+							<p>{{ tr .lang "form.reupload" }}</p>
+							<p>{{ tr .lang "form.noemail" }}</p>
 							<br/>
 							<!-- previous video upload version; might come back in the future -->
 							<!--
@@ -95,48 +104,60 @@ const Form = `
 							</ul>
 							</p>
 							-->
-							<p>If you wish to have the pre-recorded video hosted on the <a href="https://vimeo.com/bernsteinnetwork">
-							Bernstein Conference Vimeo channel</a> you must upload your video 
-							<b>before {{ .closedtextvid }}</b>! 
+							{{ if .videochannelurl }}
+							<p>{{ tr .lang "form.videochannel" (link .videochannelurl (tr .lang "form.videochannel.name" .conferencename)) .closedtextvid }}
 							<ul>
-								<li>Upload your video file here: <a href="{{ .viduploadurl }}">{{ .viduploadurl }}</a>.</li>
-								<li>Preferred format is *.mp4.</li>
-								<li>File names <b>must</b> follow the naming scheme <code>AbstractNumber_FirstAuthor</code>.</li>
-								<li><b>Other file names will not be considered</b> and authors cannot be informed.</li>
+								<li>{{ tr .lang "form.videochannel.upload" (link .viduploadurl .viduploadurl) }}</li>
+								<li>{{ tr .lang "form.videochannel.format" }}</li>
+								<li>{{ tr .lang "form.videochannel.naming" }}</li>
+								<li>{{ tr .lang "form.videochannel.ignored" }}</li>
 							</ul>
 							</p>
+							{{ end }}
 							<h3 class="ui top attached header">
-								Bernstein Conference Poster Submission Form
+								{{ tr .lang "form.title" .conferencename }}
 							</h3>
 							<div class="ui attached segment">
-								<div class="inline required field">
-									<label for="poster">Poster (PDF)</label>
-									<input type="file" id="poster" name="poster" accept="application/pdf" required>
-									<span class="help">Poster or slides</span>
+								<p>{{ tr .lang "form.optional" }}</p>
+								<div class="inline field">
+									<label for="poster">{{ tr .lang "form.poster" }}</label>
+									<input type="file" id="poster" name="poster" accept="application/pdf">
+									<span class="help">{{ tr .lang "form.poster.help" }}</span>
 								</div>
 								{{if .videos}}
 									<div class="inline field">
-										<label for="video">Video</label>
+										<label for="video">{{ tr .lang "form.video" }}</label>
 										<input type="file" id="video" name="video" accept="video/*">
-										<span class="help">Short poster presentation video</span>
+										<span class="help">{{ tr .lang "form.video.help" }}</span>
 									</div>
+									{{with .videopolicy}}
+										<ul class="help">
+											{{with .Formats}}<li>{{ tr $.lang "form.video.formats" . }}</li>{{end}}
+											{{with .MaxSize}}<li>{{ tr $.lang "form.video.maxsize" . }}</li>{{end}}
+											{{with .MaxDuration}}<li>{{ tr $.lang "form.video.maxduration" . }}</li>{{end}}
+											{{with .MaxWidth}}<li>{{ tr $.lang "form.video.maxwidth" . }}</li>{{end}}
+											{{with .MaxHeight}}<li>{{ tr $.lang "form.video.maxheight" . }}</li>{{end}}
+											{{if .Naming}}<li>{{ tr $.lang "form.video.naming" }}</li>{{end}}
+										</ul>
+									{{end}}
 								{{end}}
 								<div class="inline field">
-									<label for="video_url">Video URL</label>
+									<label for="video_url">{{ tr .lang "form.videourl" }}</label>
 									<input type="url" id="video_url" name="video_url">
-									<span class="help">Link to short self-hosted presentation</span>
+									<span class="help">{{ tr .lang "form.videourl.help" }}</span>
 								</div>
 								<div class="inline required field ">
-									<label for="passcode">Upload key</label>
+									<label for="passcode">{{ tr .lang "form.passcode" }}</label>
 									<input type="password" id="passcode" name="passcode" value="" autofocus required>
-									<span class="help">You have received an upload key in the instruction email</span>
+									<span class="help">{{ tr .lang "form.passcode.help" }}</span>
 								</div>
 								<div class="inline field">
 									<label></label>
-									<button class="ui green button">Submit</button>
+									<button class="ui green button">{{ tr .lang "form.submit" }}</button>
 								</div>
 							</div>
 						</form>
+						<p><a href="/status">{{ tr .lang "form.checkstatus" }}</a></p>
 					</div>
 				</div>
 			</div>
@@ -145,24 +166,23 @@ const Form = `
 			<div class="ui container">
 				<div class="jumbotron">
 					<div class="page-header">
-						<h1>Bernstein Conference Poster Submission</h1>
+						<h1>{{ tr .lang "layout.title" .conferencename }}</h1>
 					</div>
 
+					{{ if .bannerimage }}
 					<a href="{{ .conferencepageurl }}">
-						<img class="conference-banner img-responsive img-rounded" src="/assets/BC_online_header.jpeg" alt="Conference Logo">
+						<img class="conference-banner img-responsive img-rounded" src="{{ .bannerimage }}" alt="{{ tr .lang "form.banner" }}">
 					</a>
+					{{ end }}
 
 					<br>
 					<div class="jumbo-small center">
-						<p>Poster and video submission is <b class="red">closed</b>.<br></p>
+						<p>{{ tr .lang "form.closed" }}<br></p>
 					</div>
 					<br>
 
 					<div class="jumbo-small">
-						<p>Each year the Bernstein Network invites the international computational neuroscience community to the annual 
-							Bernstein Conference for intensive scientific exchange. It has established itself as one of the most renown 
-							conferences worldwide in this field, attracting students, postdocs and PIs from around the world to meet and 
-							discuss new scientific discoveries.<br></p>
+						<p>{{ .conferencedescription }}<br></p>
 					</div>
 				</div>
 			</div>
@@ -172,42 +192,65 @@ const Form = `
 
 // SuccessTmpl is the page displayed after a successful poster content upload.
 // It displays an overview of the posters metadata and links to the uploaded
-// content.
+// content. Title and abstract may contain basic markup which is sanitised
+// by the richtext function.
 const SuccessTmpl = `
 {{ define "content" }}
 			<div class="home middle very relaxed page grid" id="main">
 				<div class="ui container wide centered column doi">
 					<div class="column center">
-						<h1>Bernstein Conference Poster Submission Success</h1>
+						<h1>{{ tr .lang "success.title" .conferencename }}</h1>
 					</div>
 
 					<div class="ui info message" id="infotable">
 						<div id="infobox">
-							<p>Your upload was <strong>successful!</strong></p>
-							<p>The following <strong>preview</strong> shows the information that will appear in the poster gallery alongside your poster.</p>
-							<p>Please review it carefully and <strong><a href="mailto:{{.supportemail}}">contact us</a></strong> 
-								if there are any issues.</p>
+							<p>{{ tr .lang "success.successful" }}</p>
+							<p>{{ tr .lang "success.preview" }}</p>
+							<p>{{ tr .lang "success.review" (link (print "mailto:" .supportemail) (tr .lang "contact.us")) }}</p>
 						</div>
 					</div>
-					<div><b>NOTE: Please print this page or save the following for verification. 
-					You may be asked to produce the following key to verify your upload.</b></div>
-					<div>Poster upload verification: <code>{{.PosterHash}}</code></div>
+					{{with .PDFMismatch}}
+					<div class="ui warning message">
+						<p>{{ tr $.lang "success.mismatch" (link (print "mailto:" $.supportemail) (tr $.lang "contact.us")) }}</p>
+						{{if .Title}}<p>{{ tr $.lang "success.mismatch.title" .Title }}</p>{{end}}
+					</div>
+					{{end}}
+					<div>{{ tr .lang "success.note" }}</div>
+					{{if .PosterHash}}
+					<div>{{ tr .lang "success.verification" }} <code>{{.PosterHash}}</code></div>
+					{{end}}
+					<ul>
+					{{range .Parts}}
+						{{if .Changed}}
+						<li>{{ tr $.lang (print "success.part." .Name) }}: {{ tr $.lang "success.updated" }}</li>
+						{{else if .Unchanged}}
+						<li>{{ tr $.lang (print "success.part." .Name) }}: {{ tr $.lang "success.nochange" }}</li>
+						{{else if .Present}}
+						<li>{{ tr $.lang (print "success.part." .Name) }}: {{ tr $.lang "success.kept" }}</li>
+						{{end}}
+					{{end}}
+					</ul>
 					<hr>
 					{{with .UserData}}
 					<div class="doi title">
-						<h1>{{.Title}}</h1>
+						<h1>{{richtext .Title}}</h1>
 						{{.Authors}}
-						<p><strong>Session {{.Session}}</strong> | {{.AbstractNumber}} | {{.Topic}}</p>
+						<p><strong>{{ tr $.lang "success.session" .Session }}</strong> | {{.AbstractNumber}} | {{.Topic}}</p>
 					</div>
 					<hr>
 
-					<h3>Abstract</h3>
-					<p>{{.Abstract}}</p>
+					<h3>{{ tr $.lang "success.abstract" }}</h3>
+					<p>{{richtext .Abstract}}</p>
 					{{end}}
 
-					<div><a href="{{.PDFPath}}">Poster PDF</a> (click to review)</div>
+					{{if .PDFPath}}
+					{{if .PreviewURL}}
+					<div><a href="{{.PDFPath}}"><img class="ui bordered image" src="{{.PreviewURL}}" alt="{{ tr .lang "success.previewimage" }}"></a></div>
+					{{end}}
+					<div><a href="{{.PDFPath}}">{{ tr .lang "success.posterpdf" }}</a> {{ tr .lang "success.posterpdf.review" }}</div>
+					{{end}}
 					{{if .VideoURL}}
-						<div><a href="{{.VideoURL}}">{{.VideoURL}}</a>: Poster presentation video</div>
+						<div><a href="{{.VideoURL}}">{{.VideoURL}}</a>: {{ tr .lang "success.video" }}</div>
 					{{end}}
 					<hr>
 				</div>
@@ -223,16 +266,15 @@ const FailureTmpl = `
 			<div class="home middle very relaxed page grid" id="main">
 				<div class="ui container wide centered column doi">
 					<div class="column center">
-						<h1>Bernstein Conference Poster Submission</h1>
+						<h1>{{ tr .lang "failure.title" .conferencename }}</h1>
 					</div>
 					<div class="ui error message" id="infotable">
 						<div id="infobox">
-							<p>The submission failed.<p>
+							<p>{{ tr .lang "failure.failed" }}<p>
 
 							<p>{{.Message}}</p>
 
-							<p>Please <strong><a href="mailto:{{ .supportemail }}}">contact us</a></strong> 
-							if there are any issues. <a href="/">Click here</a> to return to the form and try again.</p>
+							<p>{{ tr .lang "failure.contact" (link (print "mailto:" .supportemail) (tr .lang "contact.us")) }}</p>
 						</div>
 					</div>
 					<hr>
@@ -256,22 +298,21 @@ const EmailFormTmpl = `
 		<div class="column">
 			<form class="ui form" method='post' action='/submitemail'>
 				<h3 class="ui top attached header">
-					Bernstein Conference whitelist email address upload form
+					{{ tr .lang "email.title" .conferencename }}
 				</h3>
 				<div class="ui attached segment">
 					<div class="inline required field">
-						<label for='content'>Email addresses</label>
+						<label for='content'>{{ tr .lang "email.addresses" }}</label>
 						<textarea required name='content' id='content'></textarea>
-						<span class="help">Email addresses can be separated by comma, semicolon, space, tab or newline.
-						You can always upload a full list, only new addresses are added.</span>
+						<span class="help">{{ tr .lang "email.addresses.help" }}</span>
 					</div>
 					<div class="inline required field">
-						<label for='password'>Password</label>
+						<label for='password'>{{ tr .lang "email.password" }}</label>
 						<input required type='password' name='password' id='password'>
 					</div>
 					<div class="inline field">
 						<label></label>
-						<button class="ui green button">Submit</button>
+						<button class="ui green button">{{ tr .lang "form.submit" }}</button>
 					</div>
 				</div>
 			</form>
@@ -286,10 +327,10 @@ const EmailSubmitTmpl = `
 {{ define "content" }}
 <div class="ui container">
 	<p></p>
-	<h1>Upload received</h1>
+	<h1>{{ tr .lang "email.received" }}</h1>
 	<div class="ui dividing header"></div>
-	<p>Whitelist email addresses have been uploaded.</p>
-	<p><a href='/uploademail'>Back to the email upload form</a></p>
+	<p>{{ tr .lang "email.uploaded" }}</p>
+	<p>{{ tr .lang "email.back" }}</p>
 </div>
 {{ end }}
 `
@@ -301,15 +342,15 @@ const EmailFailTmpl = `
 <div class="home middle very relaxed page grid" id="main">
 	<div class="ui container wide centered column doi">
 		<div class="column center">
-			<h1>Bernstein Conference whitelist email upload</h1>
+			<h1>{{ tr .lang "email.failtitle" .conferencename }}</h1>
 		</div>
 		<div class="ui error message" id="infotable">
 			<div id="infobox">
-				<p>The upload has failed.<p>
+				<p>{{ tr .lang "email.failed" }}<p>
 
 				<p>{{.Message}}</p>
 
-				<p><a href="/uploademail">Click here</a> to return to the upload form and try again.</p>
+				<p>{{ tr .lang "email.retry" }}</p>
 			</div>
 		</div>
 		<hr>
@@ -318,4 +359,231 @@ const EmailFailTmpl = `
 {{ end }}
 `
 
+// StatusFormTmpl is the form presenters use to enter their upload key to
+// check their current submission.
+const StatusFormTmpl = `
+{{ define "content" }}
+<div class="body">
+	<div class="ui middle very relaxed page grid">
+		<div class="column"></div>
+	</div>
+</div>
+<div class="ginform">
+	<div class="ui middle very relaxed page grid">
+		<div class="column">
+			<form class="ui form" method="post" action="/status">
+				<h3 class="ui top attached header">
+					{{ tr .lang "status.formtitle" .conferencename }}
+				</h3>
+				<div class="ui attached segment">
+					<p>{{ tr .lang "status.intro" }}</p>
+					<div class="inline required field">
+						<label for="passcode">{{ tr .lang "form.passcode" }}</label>
+						<input type="password" id="passcode" name="passcode" value="" autofocus required>
+						<span class="help">{{ tr .lang "form.passcode.help" }}</span>
+					</div>
+					<div class="inline field">
+						<label></label>
+						<button class="ui green button">{{ tr .lang "status.show" }}</button>
+					</div>
+				</div>
+			</form>
+		</div>
+	</div>
+</div>
+{{ end }}
+`
+
+// StatusTmpl displays the poster metadata and the currently stored
+// submission of a presenter including all older versions kept.
+const StatusTmpl = `
+{{ define "content" }}
+			<div class="home middle very relaxed page grid" id="main">
+				<div class="ui container wide centered column doi">
+					<div class="column center">
+						<h1>{{ tr .lang "status.title" .conferencename }}</h1>
+					</div>
+					<div class="ui info message" id="infotable">
+						<div id="infobox">
+							<p>{{ tr .lang "success.preview" }}</p>
+							<p>{{ tr .lang "success.review" (link (print "mailto:" .supportemail) (tr .lang "contact.us")) }}</p>
+						</div>
+					</div>
+					{{with .UserData}}
+					<div class="doi title">
+						<h1>{{richtext .Title}}</h1>
+						{{.Authors}}
+						<p><strong>{{ tr $.lang "success.session" .Session }}</strong> | {{.AbstractNumber}} | {{.Topic}}</p>
+					</div>
+					<hr>
+
+					<h3>{{ tr $.lang "success.abstract" }}</h3>
+					<p>{{richtext .Abstract}}</p>
+					{{end}}
+					<hr>
+
+					<h3>{{ tr .lang "status.current" }}</h3>
+					{{with .Submission}}
+					<table class="ui table">
+						<tbody>
+							<tr>
+								<td>{{ tr $.lang "success.posterpdf" }}</td>
+								{{if .Poster}}
+								<td>
+									{{if .Thumbnail}}<a href="{{if .Preview}}{{.Preview.URL}}{{else}}{{.Thumbnail.URL}}{{end}}"><img src="{{.Thumbnail.URL}}" alt="{{ tr $.lang "success.previewimage" }}"></a><br>{{end}}
+									<a href="{{.Poster.URL}}">{{.Poster.Name}}</a>
+								</td>
+								<td>{{ tr $.lang "status.uploaded" (.Poster.Modified.Format "2006-01-02 15:04:05 MST") }}</td>
+								<td><code>{{.Poster.SHA1}}</code></td>
+								{{else}}
+								<td colspan="3">{{ tr $.lang "status.none" }}</td>
+								{{end}}
+							</tr>
+							{{if .Video}}
+							<tr>
+								<td>{{ tr $.lang "form.video" }}</td>
+								<td><a href="{{.Video.URL}}">{{.Video.Name}}</a></td>
+								<td>{{ tr $.lang "status.uploaded" (.Video.Modified.Format "2006-01-02 15:04:05 MST") }}</td>
+								<td><code>{{.Video.SHA1}}</code></td>
+							</tr>
+							{{end}}
+							{{with $.Transcode}}
+							<tr>
+								<td>{{ tr $.lang "status.transcode" }}</td>
+								<td colspan="3">{{ tr $.lang (print "status.transcode." .State) }}</td>
+							</tr>
+							{{end}}
+							<tr>
+								<td>{{ tr $.lang "form.videourl" }}</td>
+								{{if .VideoURL}}
+								<td colspan="3"><a href="{{.VideoURL}}">{{.VideoURL}}</a></td>
+								{{else}}
+								<td colspan="3">{{ tr $.lang "status.none" }}</td>
+								{{end}}
+							</tr>
+						</tbody>
+					</table>
+					{{end}}
+
+					<h3>{{ tr .lang "status.versions" }}</h3>
+					{{if .Versions}}
+					<table class="ui table">
+						<tbody>
+							{{range .Versions}}
+							<tr>
+								<td><a href="{{.URL}}" download>{{.Name}}</a></td>
+								<td>{{ tr $.lang "status.uploaded" (.Uploaded.Format "2006-01-02 15:04:05 MST") }}</td>
+								<td>{{if .Content}}<a href="{{.Content}}">{{.Content}}</a>{{else if .SHA1}}<code>{{.SHA1}}</code>{{end}}</td>
+							</tr>
+							{{end}}
+						</tbody>
+					</table>
+					{{else}}
+					<p>{{ tr .lang "status.noversions" }}</p>
+					{{end}}
+					<hr>
+
+					<h3>{{ tr .lang "status.actions" }}</h3>
+					{{if .Submission.VideoURL}}
+					<form class="ui form" method="post" action="/status/clearvideourl">
+						<input type="hidden" name="passcode" value="{{.Passcode}}">
+						<p>{{ tr .lang "status.clearvideourl.help" }}</p>
+						<button class="ui button">{{ tr .lang "status.clearvideourl" }}</button>
+					</form>
+					<br>
+					{{end}}
+					<form class="ui form" method="post" action="/status/withdraw">
+						<input type="hidden" name="passcode" value="{{.Passcode}}">
+						<p>{{ tr .lang "status.withdraw.help" }}</p>
+						<div class="inline required field">
+							<input type="checkbox" id="confirm" name="confirm" value="yes" required>
+							<label for="confirm">{{ tr .lang "status.withdraw.confirm" }}</label>
+						</div>
+						<button class="ui red button">{{ tr .lang "status.withdraw" }}</button>
+					</form>
+					<hr>
+					<p><a href="/">{{ tr .lang "status.back" }}</a></p>
+				</div>
+			</div>
+		</div>
+{{ end }}
+`
+
+// ActionTmpl is the page displayed after a presenter changed their
+// submission on the status page.
+const ActionTmpl = `
+{{ define "content" }}
+<div class="ui container">
+	<p></p>
+	<h1>{{ tr .lang "action.title" }}</h1>
+	<div class="ui dividing header"></div>
+	<p>{{.Message}}</p>
+	<p><a href="/status">{{ tr .lang "form.checkstatus" }}</a> | <a href="/">{{ tr .lang "status.back" }}</a></p>
+</div>
+{{ end }}
+`
+
+// AdminChecksTmpl is the admin dashboard listing the stored PDF check
+// results of the posters.
+const AdminChecksTmpl = `
+{{ define "content" }}
+<div class="ui container">
+	<p></p>
+	<h1>{{ tr .lang "checks.title" .conferencename }}</h1>
+	<div class="ui dividing header"></div>
+	{{if .All}}
+	<p>{{ tr .lang "checks.intro.all" }} <a href="?">{{ tr .lang "checks.showmismatches" }}</a></p>
+	{{else}}
+	<p>{{ tr .lang "checks.intro" }} <a href="?all=true">{{ tr .lang "checks.showall" }}</a></p>
+	{{end}}
+	{{if .Checks}}
+	<table class="ui table">
+		<thead>
+			<tr>
+				<th>{{ tr .lang "checks.poster" }}</th>
+				<th>{{ tr .lang "checks.pdftitle" }}</th>
+				<th>{{ tr .lang "checks.titlescore" }}</th>
+				<th>{{ tr .lang "checks.authors" }}</th>
+				<th>{{ tr .lang "checks.checked" }}</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Checks}}
+			<tr{{if .Mismatch}} class="warning"{{end}}>
+				<td><strong>{{.ID}}</strong> {{richtext .Title}}{{if .Mismatch}}<br><span class="ui red label">{{ tr $.lang "checks.mismatch" }}</span>{{end}}</td>
+				<td>{{.pdfCheck.Title}}</td>
+				<td>{{printf "%.2f" .TitleScore}}</td>
+				<td>{{range $idx, $name := .AuthorsFound}}{{if $idx}}, {{end}}{{$name}}{{end}}</td>
+				<td>{{.Checked.Format "2006-01-02 15:04:05 MST"}}</td>
+			</tr>
+			{{end}}
+		</tbody>
+	</table>
+	{{else}}
+	<p>{{ tr .lang "checks.none" }}</p>
+	{{end}}
+</div>
+{{ end }}
+`
+
+// ReadmeTmpl is the Markdown README stored with each poster if
+// MetadataReadme is enabled. It is a text template executed with the
+// poster metadata.
+const ReadmeTmpl = `# {{ .Title }}
+
+{{ .Authors }}
+{{ if .Session }}
+Session {{ .Session }}{{ if .AbstractNumber }}, abstract {{ .AbstractNumber }}{{ end }}
+{{ end }}{{ if .Topic }}
+Topic: {{ .Topic }}
+{{ end }}
+{{ if .Poster }}- [Poster]({{ .Poster }})
+{{ end }}{{ if .VideoURL }}- [Video]({{ .VideoURL }})
+{{ end }}{{ if .Video }}- [Video file]({{ .Video }})
+{{ end }}{{ if .Abstract }}
+## Abstract
+
+{{ .Abstract }}
+{{ end }}`
+
 // vim: ft=gohtmltmpl
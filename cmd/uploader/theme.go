@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
+)
+
+// FooterLink is a link displayed in the page footer.
+type FooterLink struct {
+	Name string
+	URL  string
+	// Names contains translations of Name by language
+	Names map[string]string `yaml:",omitempty"`
+}
+
+// Page template names. A theme directory can override each page with a
+// file named <name>.tmpl; the layout is overridden by layout.tmpl.
+const (
+	layoutPage      = "layout"
+	formPage        = "form"
+	successPage     = "success"
+	failurePage     = "failure"
+	emailFormPage   = "emailform"
+	emailSubmitPage = "emailsubmit"
+	emailFailPage   = "emailfail"
+	statusFormPage  = "statusform"
+	statusPage      = "status"
+	actionPage      = "action"
+	adminChecksPage = "adminchecks"
+)
+
+// builtinPages maps page names to the compiled-in templates which are used
+// if a theme does not provide its own version.
+var builtinPages = map[string]string{
+	layoutPage:      Layout,
+	formPage:        Form,
+	successPage:     SuccessTmpl,
+	failurePage:     FailureTmpl,
+	emailFormPage:   EmailFormTmpl,
+	emailSubmitPage: EmailSubmitTmpl,
+	emailFailPage:   EmailFailTmpl,
+	statusFormPage:  StatusFormTmpl,
+	statusPage:      StatusTmpl,
+	actionPage:      ActionTmpl,
+	adminChecksPage: AdminChecksTmpl,
+}
+
+// readmePage is the name of the poster README template, which is a text
+// template without layout.
+const readmePage = "readme"
+
+// templateSet holds the parsed templates of all pages and the poster
+// README template.
+type templateSet struct {
+	pages  map[string]*template.Template
+	readme *texttemplate.Template
+}
+
+// builtinTemplates is the set of built-in page templates. It is used if
+// the configured theme cannot be loaded.
+var builtinTemplates templateSet
+
+func init() {
+	var err error
+	builtinTemplates, err = loadTemplates("")
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse built-in templates: %v", err))
+	}
+}
+
+// themeSource returns the template source for a page, read from the theme
+// directory if it contains the page or the built-in template otherwise.
+func themeSource(themeDir, name string) (string, error) {
+	if themeDir != "" {
+		data, err := ioutil.ReadFile(filepath.Join(themeDir, name+".tmpl"))
+		if err == nil {
+			return string(data), nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return builtinPages[name], nil
+}
+
+// loadTemplates parses the templates of all pages and the README template
+// from the theme directory, falling back to the built-in templates for
+// each template the theme does not provide. An empty themeDir uses the
+// built-in templates.
+func loadTemplates(themeDir string) (templateSet, error) {
+	layout, err := themeSource(themeDir, layoutPage)
+	if err != nil {
+		return templateSet{}, err
+	}
+	set := templateSet{pages: make(map[string]*template.Template)}
+	for name := range builtinPages {
+		if name == layoutPage {
+			continue
+		}
+		content, err := themeSource(themeDir, name)
+		if err != nil {
+			return templateSet{}, err
+		}
+		tmpl, err := parsePage(layout, content)
+		if err != nil {
+			return templateSet{}, fmt.Errorf("template %q: %v", name, err)
+		}
+		set.pages[name] = tmpl
+	}
+	if set.readme, err = loadReadmeTemplate(themeDir); err != nil {
+		return templateSet{}, err
+	}
+	return set, nil
+}
+
+// lookup returns the parsed template of the named page.
+func (set templateSet) lookup(name string) (*template.Template, error) {
+	tmpl, ok := set.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+	return tmpl, nil
+}
+
+// loadReadmeTemplate parses the poster README template from the theme
+// directory or the built-in template.
+func loadReadmeTemplate(themeDir string) (*texttemplate.Template, error) {
+	content := ReadmeTmpl
+	if themeDir != "" {
+		data, err := ioutil.ReadFile(filepath.Join(themeDir, readmePage+".tmpl"))
+		if err == nil {
+			content = string(data)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	tmpl, err := texttemplate.New(readmePage).Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %v", readmePage, err)
+	}
+	return tmpl, nil
+}
+
+// writeTheme writes all built-in templates to the provided directory to
+// be used as the starting point for a custom theme. Existing templates are
+// never overwritten: nothing is written if any of the files exists.
+func writeTheme(themeDir string) error {
+	files := map[string]string{filepath.Join(themeDir, readmePage+".tmpl"): ReadmeTmpl}
+	for name, content := range builtinPages {
+		files[filepath.Join(themeDir, name+".tmpl")] = content
+	}
+	for fname := range files {
+		if _, err := os.Lstat(fname); err == nil {
+			return fmt.Errorf("%s already exists", fname)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.MkdirAll(themeDir, 0777); err != nil {
+		return err
+	}
+	for fname, content := range files {
+		file, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = file.WriteString(content)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Wrote template %s", fname)
+	}
+	return nil
+}
+
+// templateData returns the page data required by the layout template,
+// i.e. the branding and contact information of the conference and the
+// page language determined from the request. The request may be nil.
+func (cfg *Config) templateData(w http.ResponseWriter, r *http.Request) map[string]interface{} {
+	lang := requestLanguage(w, r, cfg.DefaultLanguage)
+	return map[string]interface{}{
+		"lang":                  lang,
+		"languages":             languageLinks(r, lang),
+		"supportemail":          cfg.SupportEmail,
+		"conferencepageurl":     cfg.ConferencePageURL,
+		"conferencename":        cfg.ConferenceName,
+		"conferencedescription": cfg.ConferenceDescription,
+		"galleryurl":            cfg.GalleryURL,
+		"bannerimage":           cfg.BannerImage,
+		"videochannelurl":       cfg.VideoChannelURL,
+		"twittersite":           cfg.TwitterSite,
+		"copyrightyear":         cfg.CopyrightYear,
+		"copyrightholder":       cfg.CopyrightHolder,
+		"copyrightholderurl":    cfg.CopyrightHolderURL,
+		"copyrightholderlogo":   cfg.CopyrightHolderLogo,
+		"footerlinks":           cfg.FooterLinks,
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	set, err := loadTemplates("")
+	if err != nil {
+		t.Fatalf("Failed to load built-in templates: %v", err)
+	}
+	for name := range builtinPages {
+		if name == layoutPage {
+			continue
+		}
+		if _, err := set.lookup(name); err != nil {
+			t.Fatalf("Missing built-in template %q: %v", name, err)
+		}
+	}
+	if _, err := set.lookup("nonexistent"); err == nil {
+		t.Fatal("Expected error for unknown template")
+	}
+}
+
+func TestThemeDirectory(t *testing.T) {
+	themeDir, err := ioutil.TempDir("", "test_bc_theme")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(themeDir)
+
+	custom := `{{ define "content" }}custom failure: {{ .Message }}{{ end }}`
+	if err := ioutil.WriteFile(filepath.Join(themeDir, "failure.tmpl"), []byte(custom), 0644); err != nil {
+		t.Fatalf("Error writing theme template: %v", err)
+	}
+	set, err := loadTemplates(themeDir)
+	if err != nil {
+		t.Fatalf("Failed to load theme: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.ConferenceName = "Test Conference"
+	cfg.CopyrightYear = "2042"
+	cfg.FooterLinks = []FooterLink{{Name: "Custom Link", URL: "https://example.com/link"}}
+	data := cfg.templateData(nil, nil)
+	data["Message"] = "failpagemessage"
+
+	// overridden page uses the custom content with the built-in layout
+	buf := new(bytes.Buffer)
+	tmpl, _ := set.lookup(failurePage)
+	if err := tmpl.Execute(buf, data); err != nil {
+		t.Fatalf("Failed to render custom template: %v", err)
+	}
+	for _, item := range []string{"custom failure: failpagemessage", "Test Conference", "© 2042", "https://example.com/link"} {
+		if !strings.Contains(buf.String(), item) {
+			t.Fatalf("Rendered page is missing %q", item)
+		}
+	}
+
+	// other pages fall back to the built-in templates
+	buf.Reset()
+	tmpl, _ = set.lookup(successPage)
+	if err := tmpl.Execute(buf, data); err != nil {
+		t.Fatalf("Failed to render built-in template: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Test Conference Poster Submission Success") {
+		t.Fatal("Built-in template does not use the configured conference name")
+	}
+
+	// invalid theme templates are reported
+	if err := ioutil.WriteFile(filepath.Join(themeDir, "form.tmpl"), []byte("{{ .broken "), 0644); err != nil {
+		t.Fatalf("Error writing theme template: %v", err)
+	}
+	if _, err := loadTemplates(themeDir); err == nil {
+		t.Fatal("Expected error for invalid theme template")
+	}
+}
+
+func TestWriteTheme(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test_bc_theme")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	themeDir := filepath.Join(tmpDir, "theme")
+	if err := writeTheme(themeDir); err != nil {
+		t.Fatalf("Error writing theme: %v", err)
+	}
+	if _, err := loadTemplates(themeDir); err != nil {
+		t.Fatalf("Written theme cannot be loaded: %v", err)
+	}
+
+	// customised templates are not overwritten
+	custom := filepath.Join(themeDir, "failure.tmpl")
+	if err := ioutil.WriteFile(custom, []byte("custom"), 0644); err != nil {
+		t.Fatalf("Error writing theme template: %v", err)
+	}
+	if err := writeTheme(themeDir); err == nil {
+		t.Fatal("Expected error writing to an existing theme")
+	}
+	if data, _ := ioutil.ReadFile(custom); string(data) != "custom" {
+		t.Fatalf("Theme template overwritten: %q", data)
+	}
+}
+
+func TestUploaderTemplates(t *testing.T) {
+	themeDir, err := ioutil.TempDir("", "test_bc_theme")
+	if err != nil {
+		t.Fatalf("Error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(themeDir)
+
+	custom := `{{ define "content" }}custom status form{{ end }}`
+	if err := ioutil.WriteFile(filepath.Join(themeDir, "statusform.tmpl"), []byte(custom), 0644); err != nil {
+		t.Fatalf("Error writing theme template: %v", err)
+	}
+	cfg := defaultConfig()
+	cfg.ThemeDirectory = themeDir
+	themed := NewUploader(cfg)
+	// a second uploader does not replace the theme of the first one
+	plain := NewUploader(defaultConfig())
+
+	for _, item := range []struct {
+		uploader *Uploader
+		custom   bool
+	}{{themed, true}, {plain, false}} {
+		w := httptest.NewRecorder()
+		item.uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+		if strings.Contains(w.Body.String(), "custom status form") != item.custom {
+			t.Fatalf("Unexpected status form of uploader with custom theme %v: %s", item.custom, w.Body.String())
+		}
+	}
+}
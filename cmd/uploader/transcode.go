@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// transcodeTimeout is the maximum run time of a single transcoding.
+const transcodeTimeout = 2 * time.Hour
+
+// States of transcoding jobs
+const (
+	transcodeQueued  = "queued"
+	transcodeRunning = "running"
+	transcodeDone    = "done"
+	transcodeFailed  = "failed"
+)
+
+// transcodeJob converts the current video of a poster to the standard MP4
+// profile.
+type transcodeJob struct {
+	ID string `json:"id"`
+	// Source is the stored video and SourceSHA1 its hash when queued; the
+	// result is discarded if the video was replaced in the meantime
+	Source     string    `json:"source"`
+	SourceSHA1 string    `json:"source_sha1"`
+	State      string    `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	Queued     time.Time `json:"queued"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+}
+
+// videoTranscoder converts a video file to the standard MP4 profile.
+type videoTranscoder interface {
+	Transcode(input, output string) error
+}
+
+// commandTranscoder transcodes videos with an external command such as
+// ffmpeg. The placeholders {input} and {output} are replaced in the
+// arguments.
+type commandTranscoder struct {
+	args []string
+}
+
+// Transcode runs the command and fails if it does not create the output.
+func (ct commandTranscoder) Transcode(input, output string) error {
+	replacer := strings.NewReplacer("{input}", input, "{output}", output)
+	if _, err := runCommandTimeout(ct.args, replacer, transcodeTimeout); err != nil {
+		return err
+	}
+	if info, err := os.Stat(output); err != nil || info.Size() == 0 {
+		return fmt.Errorf("%s did not create %s", ct.args[0], output)
+	}
+	return nil
+}
+
+// newTranscoder returns the video transcoder for the configuration or nil
+// if transcoding is disabled.
+func newTranscoder(cfg *Config) videoTranscoder {
+	args := strings.Fields(cfg.TranscodeCommand)
+	if len(args) == 0 {
+		return nil
+	}
+	return commandTranscoder{args: args}
+}
+
+// transcodeQueue runs transcoding jobs in a pool of TranscodeWorkers
+// workers. There is at most one job per poster, which is kept after it
+// finished so presenters can see its state. Jobs are saved to
+// TranscodeQueueFile after every change, so pending jobs survive a
+// restart.
+type transcodeQueue struct {
+	sync.Mutex
+	config func() *Config
+	// transcoder converts the videos; transcoding fails without one
+	transcoder videoTranscoder
+	// readme is the template of the README written with the metadata
+	readme *texttemplate.Template
+	jobs   map[string]*transcodeJob
+	wake   chan struct{}
+	// done is called with the poster ID after a video was replaced
+	done func(id string)
+}
+
+// newTranscodeQueue returns a queue with the jobs loaded from the queue
+// file of the configuration. Jobs interrupted by a restart are queued
+// again.
+func newTranscodeQueue(config func() *Config, readme *texttemplate.Template) (*transcodeQueue, error) {
+	tq := &transcodeQueue{config: config, transcoder: newTranscoder(config()), readme: readme, jobs: make(map[string]*transcodeJob), wake: make(chan struct{}, 1), done: func(string) {}}
+	data, err := ioutil.ReadFile(config().TranscodeQueueFile)
+	if os.IsNotExist(err) {
+		return tq, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &tq.jobs); err != nil {
+		return nil, fmt.Errorf("invalid transcode queue file %q: %v", config().TranscodeQueueFile, err)
+	}
+	for _, job := range tq.jobs {
+		if job.State == transcodeRunning {
+			job.State = transcodeQueued
+		}
+	}
+	return tq, nil
+}
+
+// save writes the jobs; the caller must hold the lock.
+func (tq *transcodeQueue) save() error {
+	data, err := json.MarshalIndent(tq.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	fname := tq.config().TranscodeQueueFile
+	tmpfile := fname + ".tmp"
+	if err := ioutil.WriteFile(tmpfile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, fname)
+}
+
+// Enqueue requests transcoding a stored video of a poster, replacing any
+// earlier job of the poster.
+func (tq *transcodeQueue) Enqueue(id string, video *storedFile) {
+	tq.Lock()
+	tq.jobs[id] = &transcodeJob{ID: id, Source: video.Name, SourceSHA1: video.SHA1, State: transcodeQueued, Queued: time.Now()}
+	if err := tq.save(); err != nil {
+		log.Printf("ERROR saving transcode queue: %v", err)
+	}
+	tq.Unlock()
+	log.Printf("Video %s of %q queued for transcoding", video.Name, id)
+
+	select {
+	case tq.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Remove drops the job of a poster, e.g. when a standard video replaced
+// the one being transcoded.
+func (tq *transcodeQueue) Remove(id string) {
+	tq.Lock()
+	defer tq.Unlock()
+	if _, ok := tq.jobs[id]; !ok {
+		return
+	}
+	delete(tq.jobs, id)
+	if err := tq.save(); err != nil {
+		log.Printf("ERROR saving transcode queue: %v", err)
+	}
+}
+
+// Status returns a copy of the job of a poster or nil if there is none.
+func (tq *transcodeQueue) Status(id string) *transcodeJob {
+	tq.Lock()
+	defer tq.Unlock()
+	job, ok := tq.jobs[id]
+	if !ok {
+		return nil
+	}
+	status := *job
+	return &status
+}
+
+// Start runs the configured number of workers until the process ends.
+func (tq *transcodeQueue) Start() {
+	for idx := 0; idx < tq.config().TranscodeWorkers; idx++ {
+		go tq.run()
+	}
+}
+
+// run processes jobs until the process ends.
+func (tq *transcodeQueue) run() {
+	for {
+		for tq.Process() {
+		}
+		<-tq.wake
+		// other workers may be idle as well
+		select {
+		case tq.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Process runs the oldest queued job and returns false if there was none.
+func (tq *transcodeQueue) Process() bool {
+	tq.Lock()
+	var job *transcodeJob
+	for _, queued := range tq.jobs {
+		if queued.State == transcodeQueued && (job == nil || queued.Queued.Before(job.Queued)) {
+			job = queued
+		}
+	}
+	if job == nil {
+		tq.Unlock()
+		return false
+	}
+	job.State = transcodeRunning
+	job.Started = time.Now()
+	if err := tq.save(); err != nil {
+		log.Printf("ERROR saving transcode queue: %v", err)
+	}
+	running := *job
+	tq.Unlock()
+
+	replaced, err := transcodeVideo(tq.config(), tq.transcoder, tq.readme, &running)
+
+	tq.Lock()
+	// the job may have been replaced by a newer upload while running
+	if tq.jobs[running.ID] == job {
+		job.Finished = time.Now()
+		job.State = transcodeDone
+		if err != nil {
+			job.State = transcodeFailed
+			job.Error = err.Error()
+		}
+		if err := tq.save(); err != nil {
+			log.Printf("ERROR saving transcode queue: %v", err)
+		}
+	}
+	tq.Unlock()
+
+	if err != nil {
+		log.Printf("ERROR transcoding video of %q: %v", running.ID, err)
+	} else if replaced {
+		tq.done(running.ID)
+	}
+	return true
+}
+
+// transcodeVideo converts the source video of a job and replaces it with
+// <ID>.mp4, keeping the source as an older version. It returns false if
+// the source was replaced since the job was queued.
+func transcodeVideo(cfg *Config, transcoder videoTranscoder, readme *texttemplate.Template, job *transcodeJob) (bool, error) {
+	if transcoder == nil {
+		return false, fmt.Errorf("transcoding is disabled")
+	}
+	store := newStorage(cfg)
+	current := func() bool {
+		stored, err := statStored(store, job.Source)
+		return err == nil && stored.SHA1 == job.SourceSHA1
+	}
+	if !current() {
+		log.Printf("Video %s of %q changed, transcoding skipped", job.Source, job.ID)
+		return false, nil
+	}
+
+	input, cleanup, err := localFile(store, job.Source)
+	if err != nil {
+		return false, err
+	}
+	defer cleanup()
+	tmpDir, err := ioutil.TempDir("", "uploader-transcode")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpDir)
+	target := job.ID + ".mp4"
+	output := filepath.Join(tmpDir, target)
+	started := time.Now()
+	if err := transcoder.Transcode(input, output); err != nil {
+		return false, err
+	}
+	// a submission or restore must not replace the source between the
+	// check and the replacement
+	defer lockPoster(job.ID)()
+	if !current() {
+		log.Printf("Video %s of %q changed while transcoding, result discarded", job.Source, job.ID)
+		return false, nil
+	}
+
+	// the source is kept as an older version of itself
+	if err := rotateVersions(cfg, store, job.Source); err != nil {
+		return false, err
+	}
+	if target != job.Source {
+		if err := rotateVersions(cfg, store, target); err != nil {
+			return false, err
+		}
+	}
+	content, err := os.Open(output)
+	if err != nil {
+		return false, err
+	}
+	defer content.Close()
+	if err := store.Save(target, content); err != nil {
+		return false, err
+	}
+	log.Printf("Video %s of %q transcoded to %s in %s", job.Source, job.ID, target, time.Since(started).Round(time.Second))
+
+	if err := writeMetadata(cfg, readme, job.ID); err != nil {
+		log.Printf("Failed to write metadata of %q: %v", job.ID, err)
+	}
+	return true, appendManifest(cfg, manifestEntry{ID: job.ID, Action: actionTranscode, Actor: actorSystem, Files: []string{job.Source}})
+}
+
+// transcode queues the video of a submission for transcoding if it does not
+// match the standard profile. Standard videos cancel earlier jobs.
+func (uploader *Uploader) transcode(result *submissionResult) {
+	if uploader.transcoder == nil || !result.changed(partVideo) || result.Video == nil {
+		return
+	}
+	if result.VideoInfo != nil && result.VideoInfo.Standard() && strings.EqualFold(filepath.Ext(result.Video.Name), ".mp4") {
+		uploader.transcoder.Remove(result.ID)
+		return
+	}
+	uploader.transcoder.Enqueue(result.ID, result.Video)
+}
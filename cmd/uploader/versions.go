@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// versionTimeFormat formats the upload time in the names of older versions.
+const versionTimeFormat = "20060102T150405Z"
+
+// posterLock serialises changes to the stored files of one poster.
+type posterLock struct {
+	sync.Mutex
+	// users counts the holders and waiters of the lock
+	users int
+}
+
+// posterLocks holds the locks of the posters currently being changed and
+// posterLocksMutex guards the map.
+var (
+	posterLocks      = make(map[string]*posterLock)
+	posterLocksMutex sync.Mutex
+)
+
+// lockPoster locks the stored files of a poster until the returned function
+// is called. Submissions, restores, presenter actions and transcoding hold
+// the lock while they compare and replace the current files, so e.g. a
+// transcoded video never replaces a video uploaded in the meantime.
+func lockPoster(id string) func() {
+	posterLocksMutex.Lock()
+	lock, ok := posterLocks[id]
+	if !ok {
+		lock = &posterLock{}
+		posterLocks[id] = lock
+	}
+	lock.users++
+	posterLocksMutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		posterLocksMutex.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(posterLocks, id)
+		}
+		posterLocksMutex.Unlock()
+	}
+}
+
+// fileVersion is an older version of an uploaded file.
+type fileVersion struct {
+	*storedFile
+	// Version identifies the version by upload time and hash
+	Version string
+	// Uploaded is the time the version was uploaded
+	Uploaded time.Time
+	// Content holds the video URL for versions of URL files
+	Content string
+}
+
+// newVersion returns the version of a stored file named after its upload
+// time and the start of its hash. Versions of identical files uploaded at
+// the same time have the same name.
+func newVersion(stored *storedFile) string {
+	return stored.Modified.UTC().Format(versionTimeFormat) + "-" + stored.SHA1[:8]
+}
+
+// archiveCurrent keeps the current file as an older version. Versions are
+// never renamed, so their names and URLs stay valid until they are pruned.
+func archiveCurrent(store storage, name string) error {
+	stored, err := statStored(store, name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	id, current, version, ok := parseStoredName(name)
+	if !ok || version != "" {
+		return fmt.Errorf("%q is not a current poster file", name)
+	}
+	target := versionName(id, current, newVersion(stored))
+	if _, err := store.Stat(target); err == nil {
+		log.Printf("Version %s already kept, deleting %s", target, name)
+		return store.Delete(name)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	log.Printf("Keeping %s as %s", name, target)
+	return store.Rename(name, target)
+}
+
+// pruneVersions deletes the older versions of a file exceeding the
+// configured number of versions or age and returns the number deleted.
+func pruneVersions(cfg *Config, store storage, name string) (int, error) {
+	versions, err := listVersions(store, name)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	oldest := time.Now().AddDate(0, 0, -cfg.KeepVersionsDays)
+	for idx, version := range versions {
+		// KeepVersions includes the current file
+		tooMany := cfg.KeepVersions > 0 && idx >= cfg.KeepVersions-1
+		tooOld := cfg.KeepVersionsDays > 0 && version.Uploaded.Before(oldest)
+		if !tooMany && !tooOld {
+			continue
+		}
+		log.Printf("Deleting old file %s", version.Name)
+		if err := store.Delete(version.Name); err != nil && !os.IsNotExist(err) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// pruneAllVersions applies the retention settings to the older versions of
+// all stored files and returns the number of versions deleted.
+func pruneAllVersions(cfg *Config) (int, error) {
+	store := newStorage(cfg)
+	names, err := store.List("")
+	if err != nil {
+		return 0, err
+	}
+	// versions are pruned for their current file, which may not exist
+	// anymore after the video URL was cleared
+	currents := make(map[string]bool)
+	for _, name := range names {
+		if _, current, version, ok := parseStoredName(name); ok && version != "" {
+			currents[current] = true
+		}
+	}
+	deleted := 0
+	for current := range currents {
+		n, err := pruneVersions(cfg, store, current)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// rotateVersions keeps the current file as an older version before it is
+// replaced and applies the retention settings.
+func rotateVersions(cfg *Config, store storage, name string) error {
+	if err := archiveCurrent(store, name); err != nil {
+		return err
+	}
+	_, err := pruneVersions(cfg, store, name)
+	return err
+}
+
+// versionUploaded returns the upload time of a version from its name, or
+// the modification time for numbered versions of older uploads.
+func versionUploaded(version string, stored *storedFile) time.Time {
+	if len(version) >= len(versionTimeFormat) {
+		if uploaded, err := time.Parse(versionTimeFormat, version[:len(versionTimeFormat)]); err == nil {
+			return uploaded
+		}
+	}
+	return stored.Modified
+}
+
+// listVersions returns all older versions of a stored file, newest first.
+func listVersions(store storage, name string) ([]fileVersion, error) {
+	id, current, _, ok := parseStoredName(name)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a poster file", name)
+	}
+	names, err := store.List(id + "-v")
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]fileVersion, 0, len(names))
+	for _, name := range names {
+		versionID, versionCurrent, version, ok := parseStoredName(name)
+		if !ok || version == "" || versionID != id || versionCurrent != current {
+			continue
+		}
+		// versions are not hashed, they may be large videos
+		stored, err := store.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		fv := fileVersion{storedFile: stored, Version: version, Uploaded: versionUploaded(version, stored)}
+		if filepath.Ext(name) == ".url" {
+			if fv.Content, err = readStored(store, name); err != nil {
+				return nil, err
+			}
+		}
+		versions = append(versions, fv)
+	}
+	// versions uploaded within the same second are ordered by modification
+	sort.SliceStable(versions, func(i, j int) bool {
+		if !versions[i].Uploaded.Equal(versions[j].Uploaded) {
+			return versions[i].Uploaded.After(versions[j].Uploaded)
+		}
+		return versions[i].Modified.After(versions[j].Modified)
+	})
+	return versions, nil
+}
+
+// restoreVersion makes an older version of a poster file the current file.
+// The current file is kept as an older version and the preview images and
+// metadata are regenerated. Nothing changes if the version is identical to
+// the current file.
+func (uploader *Uploader) restoreVersion(cfg *Config, id, name, actor string) error {
+	versionID, current, version, ok := parseStoredName(name)
+	if !ok || version == "" || versionID != id {
+		return fmt.Errorf("%q is not a version of poster %q", name, id)
+	}
+	defer lockPoster(id)()
+	store := newStorage(cfg)
+	restored, err := statStored(store, name)
+	if err != nil {
+		return err
+	}
+	if stored, err := statStored(store, current); err == nil && stored.SHA1 == restored.SHA1 {
+		log.Printf("Version %s of %q identical to %s, no change", name, id, current)
+		return nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// the content is copied before the current file is archived; the
+	// version itself is only pruned after the copy was stored
+	path, cleanup, err := localFile(store, name)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	content, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	if err := archiveCurrent(store, current); err != nil {
+		return err
+	}
+	if err := store.Save(current, content); err != nil {
+		return err
+	}
+	if _, err := pruneVersions(cfg, store, current); err != nil {
+		log.Printf("ERROR pruning versions of %s: %v", current, err)
+	}
+	log.Printf("Version %s of %q restored by %s", name, id, actor)
+
+	if strings.EqualFold(filepath.Ext(current), ".pdf") {
+		if err := renderPreviews(cfg, uploader.rendererFor(cfg), id); err != nil {
+			log.Printf("Failed to render previews of %q: %v", id, err)
+		}
+		if user, err := findPoster(cfg, id); err != nil {
+			log.Printf("Failed to check PDF of %q: %v", id, err)
+		} else if _, err := storePosterCheck(cfg, uploader.extractorFor(cfg), user); err != nil {
+			log.Printf("Failed to check PDF of %q: %v", id, err)
+		}
+	}
+	if err := writeMetadata(cfg, uploader.templates.readme, id); err != nil {
+		log.Printf("Failed to write metadata of %q: %v", id, err)
+	}
+	return appendManifest(cfg, manifestEntry{ID: id, Action: actionRestore, Actor: actor, Files: []string{name}})
+}
+
+// adminRestore restores the older version of a poster file named by the
+// version parameter.
+func (uploader *Uploader) adminRestore(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	name := r.FormValue("version")
+	if versionID, _, version, ok := parseStoredName(name); !ok || version == "" || versionID != id {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid version"})
+		return
+	}
+	err := uploader.restoreVersion(uploader.Config(), id, name, adminActor(r))
+	if os.IsNotExist(err) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "version not found"})
+		return
+	} else if err != nil {
+		log.Printf("ERROR restoring %s: %v", name, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	uploader.publish(id)
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "action": actionRestore, "version": name})
+}
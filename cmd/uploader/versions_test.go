@@ -0,0 +1,235 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uploadVersions stores the contents as successive uploads of id.pdf, one
+// day apart and the last one uploaded a minute from now.
+func uploadVersions(t *testing.T, cfg *Config, contents ...string) {
+	store := newStorage(cfg)
+	for idx, content := range contents {
+		if err := rotateVersions(cfg, store, "id.pdf"); err != nil {
+			t.Fatalf("Error rotating versions: %v", err)
+		}
+		if err := store.Save("id.pdf", strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		uploaded := time.Now().AddDate(0, 0, idx+1-len(contents)).Add(time.Minute)
+		os.Chtimes(filepath.Join(cfg.UploadDirectory, "id.pdf"), uploaded, uploaded)
+	}
+}
+
+// versionContents returns the contents of the older versions of id.pdf,
+// newest first.
+func versionContents(t *testing.T, cfg *Config) []string {
+	store := newStorage(cfg)
+	versions, err := listVersions(store, "id.pdf")
+	if err != nil {
+		t.Fatalf("Error listing versions: %v", err)
+	}
+	contents := make([]string, 0, len(versions))
+	for _, version := range versions {
+		data, err := readStored(store, version.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, data)
+	}
+	return contents
+}
+
+func TestRotateVersions(t *testing.T) {
+	for _, test := range []struct {
+		keep, days int
+		expected   string
+	}{
+		// KeepVersions includes the current file
+		{keep: 1, expected: ""},
+		{keep: 2, expected: "third"},
+		{keep: 3, expected: "third second"},
+		// no limit
+		{keep: 0, expected: "third second first"},
+		// versions uploaded more than a day ago are deleted
+		{keep: 0, days: 1, expected: "third"},
+		{keep: 1, days: 1, expected: ""},
+		{keep: 5, days: 2, expected: "third second"},
+	} {
+		uploader, cleanup := newTestUploader(t)
+		cfg := uploader.Config()
+		cfg.KeepVersions, cfg.KeepVersionsDays = test.keep, test.days
+
+		uploadVersions(t, cfg, "first", "second", "third", "fourth")
+		if data, err := readStored(newStorage(cfg), "id.pdf"); err != nil || data != "fourth" {
+			t.Errorf("Unexpected current file %q: %v", data, err)
+		}
+		if contents := strings.Join(versionContents(t, cfg), " "); contents != test.expected {
+			t.Errorf("Unexpected versions with %d versions and %d days: %q", test.keep, test.days, contents)
+		}
+		cleanup()
+	}
+}
+
+func TestArchiveIdenticalVersion(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.KeepVersions = 0
+	store := newStorage(cfg)
+
+	// the same file uploaded at the same time is only kept once
+	uploaded := time.Now().Add(-time.Hour)
+	for idx := 0; idx < 2; idx++ {
+		if err := store.Save("id.pdf", strings.NewReader("same")); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(filepath.Join(cfg.UploadDirectory, "id.pdf"), uploaded, uploaded)
+		if err := archiveCurrent(store, "id.pdf"); err != nil {
+			t.Fatalf("Error archiving file: %v", err)
+		}
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := versionName("id", "id.pdf", uploaded.UTC().Format(versionTimeFormat)+"-"+sha1String("same")[:8])
+	if _, err := store.Stat(expected); err != nil {
+		t.Fatalf("Version not named after upload time and hash: %v", err)
+	}
+
+	// nothing to archive
+	if err := archiveCurrent(store, "id.pdf"); err != nil {
+		t.Fatalf("Unexpected error archiving missing file: %v", err)
+	}
+}
+
+func TestVersionsNotRenamed(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.KeepVersions = 0
+
+	// an older version with the same content as a newer one keeps its name
+	uploadVersions(t, cfg, "first", "second", "first", "third")
+	if contents := strings.Join(versionContents(t, cfg), " "); contents != "first second first" {
+		t.Fatalf("Unexpected versions %q", contents)
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.AdminPW = "adminsecret"
+	cfg.KeepVersions = 2
+
+	uploadVersions(t, cfg, "%PDF-1.4 first", "%PDF-1.4 second")
+	versions, err := listVersions(newStorage(cfg), "id.pdf")
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("Unexpected versions %+v: %v", versions, err)
+	}
+
+	restore := func(id, version string) *httptest.ResponseRecorder {
+		form := url.Values{"version": {version}}
+		req := httptest.NewRequest("POST", "/admin/posters/"+id+"/restore", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("admin", "adminsecret")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		return w
+	}
+	for _, test := range []struct {
+		id, version string
+		status      int
+	}{
+		{"id", "id.pdf", http.StatusBadRequest},
+		{"other", versions[0].Name, http.StatusBadRequest},
+		{"id", "id-v20000101T000000Z-00000000.pdf", http.StatusNotFound},
+	} {
+		if w := restore(test.id, test.version); w.Code != test.status {
+			t.Errorf("Unexpected status code restoring %s of %s: %d", test.version, test.id, w.Code)
+		}
+	}
+
+	// the restored version replaces the current file, which is kept
+	if w := restore("id", versions[0].Name); w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d: %s", w.Code, w.Body.String())
+	}
+	if data, err := readStored(newStorage(cfg), "id.pdf"); err != nil || data != "%PDF-1.4 first" {
+		t.Fatalf("Unexpected current file %q: %v", data, err)
+	}
+	if contents := versionContents(t, cfg); len(contents) != 1 || contents[0] != "%PDF-1.4 second" {
+		t.Fatalf("Unexpected versions after restore %q", contents)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.UploadDirectory, "id-meta.json")); err != nil {
+		t.Fatalf("Metadata not written: %v", err)
+	}
+
+	entries := readManifest(t, cfg)
+	if len(entries) != 1 || entries[0].Action != actionRestore || entries[0].Files[0] != versions[0].Name {
+		t.Fatalf("Unexpected manifest entries: %+v", entries)
+	}
+}
+
+func TestRestoreVersionTwice(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.KeepVersions = 0
+
+	uploadVersions(t, cfg, "%PDF-1.4 first", "%PDF-1.4 second")
+	versions, err := listVersions(newStorage(cfg), "id.pdf")
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("Unexpected versions %+v: %v", versions, err)
+	}
+	// restoring a version identical to the current file changes nothing
+	for idx := 0; idx < 2; idx++ {
+		if err := uploader.restoreVersion(cfg, "id", versions[0].Name, actorPresenter); err != nil {
+			t.Fatalf("Error restoring %s: %v", versions[0].Name, err)
+		}
+	}
+	if data, err := readStored(newStorage(cfg), "id.pdf"); err != nil || data != "%PDF-1.4 first" {
+		t.Fatalf("Unexpected current file %q: %v", data, err)
+	}
+	if contents := strings.Join(versionContents(t, cfg), " "); contents != "%PDF-1.4 second %PDF-1.4 first" {
+		t.Fatalf("Unexpected versions %q", contents)
+	}
+	if entries := readManifest(t, cfg); len(entries) != 1 {
+		t.Fatalf("Unexpected manifest entries: %+v", entries)
+	}
+}
+
+func TestPruneAllVersions(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.KeepVersions = 0
+
+	uploadVersions(t, cfg, "first", "second", "third", "fourth")
+	store := newStorage(cfg)
+	if err := store.Save("id.url", strings.NewReader("https://example.com/video")); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploader.clearVideoURL(cfg, "id", actorPresenter); err != nil {
+		t.Fatal(err)
+	}
+
+	// versions of cleared video URLs are pruned as well
+	cfg.KeepVersions = 1
+	deleted, err := pruneAllVersions(cfg)
+	if err != nil || deleted != 4 {
+		t.Fatalf("Unexpected prune result %d: %v", deleted, err)
+	}
+	if contents := versionContents(t, cfg); len(contents) != 0 {
+		t.Fatalf("Unexpected versions %q", contents)
+	}
+	if versions, _ := listVersions(store, "id.url"); len(versions) != 0 {
+		t.Fatalf("Unexpected URL versions %+v", versions)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// videoInfo describes the container and codecs of a video file.
+type videoInfo struct {
+	// Container lists the format names reported by the prober, e.g.
+	// "mov,mp4,m4a,3gp,3g2,mj2"
+	Container  string        `json:"container"`
+	VideoCodec string        `json:"video_codec"`
+	AudioCodec string        `json:"audio_codec,omitempty"`
+	Width      int           `json:"width,omitempty"`
+	Height     int           `json:"height,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Standard returns true if the video already matches the MP4 profile
+// videos are transcoded to: H.264 video and AAC audio, if any, in an MP4
+// container.
+func (info *videoInfo) Standard() bool {
+	container := "," + info.Container + ","
+	return strings.Contains(container, ",mp4,") && info.VideoCodec == "h264" &&
+		(info.AudioCodec == "" || info.AudioCodec == "aac")
+}
+
+// videoProber reads container, codecs and duration of a video file.
+type videoProber interface {
+	Probe(path string) (*videoInfo, error)
+}
+
+// commandProber probes videos with ffprobe or a compatible command printing
+// the ffprobe JSON format. The placeholder {input} is replaced in the
+// arguments.
+type commandProber struct {
+	args []string
+}
+
+// ffprobeOutput is the part of the ffprobe JSON output read by the
+// commandProber.
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+}
+
+// Probe runs the command and fails if the file has no video stream.
+func (cp commandProber) Probe(path string) (*videoInfo, error) {
+	out, err := runCommand(cp.args, strings.NewReplacer("{input}", path))
+	if err != nil {
+		return nil, err
+	}
+	return parseProbe(out)
+}
+
+// parseProbe reads the video information from ffprobe JSON output.
+func parseProbe(data []byte) (*videoInfo, error) {
+	probe := ffprobeOutput{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid probe output: %v", err)
+	}
+	info := &videoInfo{Container: probe.Format.FormatName}
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "video" && info.VideoCodec == "":
+			info.VideoCodec, info.Width, info.Height = stream.CodecName, stream.Width, stream.Height
+		case stream.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = stream.CodecName
+		}
+	}
+	if info.VideoCodec == "" {
+		return nil, fmt.Errorf("no video stream found")
+	}
+	seconds, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q", probe.Format.Duration)
+	}
+	info.Duration = time.Duration(seconds * float64(time.Second))
+	return info, nil
+}
+
+// newProber returns the video prober for the configuration or nil if
+// probing is disabled.
+func newProber(cfg *Config) videoProber {
+	args := strings.Fields(cfg.VideoProbeCommand)
+	if len(args) == 0 {
+		return nil
+	}
+	return commandProber{args: args}
+}
+
+// proberFor returns the video prober of the uploader, which defaults to
+// the prober for the configuration.
+func (uploader *Uploader) proberFor(cfg *Config) videoProber {
+	if uploader.prober != nil {
+		return uploader.prober
+	}
+	return newProber(cfg)
+}
+
+// uploadPath returns a local path of the uploaded content. Large uploads
+// are already stored in a temporary file, others are written to one.
+func uploadPath(upload *upload) (string, func(), error) {
+	if file, ok := upload.content.(*os.File); ok {
+		return file.Name(), func() {}, nil
+	}
+	if _, err := upload.content.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	tmpfile, err := ioutil.TempFile("", "uploader-*"+filepath.Ext(upload.name))
+	if err != nil {
+		return "", nil, err
+	}
+	defer tmpfile.Close()
+	cleanup := func() { os.Remove(tmpfile.Name()) }
+	if _, err := io.Copy(tmpfile, upload.content); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tmpfile.Name(), cleanup, nil
+}
+
+// probeUpload checks that an uploaded video can be read and does not
+// exceed the maximum duration. It returns nil information without a
+// prober.
+func probeUpload(cfg *Config, prober videoProber, id string, upload *upload) (*videoInfo, *submissionError) {
+	if prober == nil {
+		return nil, nil
+	}
+	path, cleanup, err := uploadPath(upload)
+	if err != nil {
+		log.Printf("ERROR reading %q uploaded for %q: %v", upload.name, id, err)
+		return nil, newSubmissionError(http.StatusInternalServerError, "storage_error", "error.internal")
+	}
+	defer cleanup()
+	info, err := prober.Probe(path)
+	if err != nil {
+		log.Printf("Video %q uploaded for %q refused: %v", upload.name, id, err)
+		return nil, newSubmissionError(http.StatusUnprocessableEntity, "invalid_video", "error.videoinvalid", upload.name)
+	}
+	log.Printf("Video %q uploaded for %q: %s, %s/%s, %dx%d, %s", upload.name, id, info.Container, info.VideoCodec, info.AudioCodec, info.Width, info.Height, info.Duration)
+	if serr := checkVideoInfo(cfg, upload, info); serr != nil {
+		log.Printf("Video %q uploaded for %q refused: %v", upload.name, id, serr)
+		return nil, serr
+	}
+	return info, nil
+}
+
+// containerNames maps video file extensions to the format names reported by
+// the prober where they differ.
+var containerNames = map[string]string{"mkv": "matroska", "m4v": "mp4", "mpg": "mpeg"}
+
+// videoExtensions are the file extensions of videos accepted if no video
+// formats are configured.
+var videoExtensions = []string{"mp4", "m4v", "mov", "webm", "mkv", "avi", "mpg", "mpeg", "ogv", "wmv"}
+
+// acceptedVideoFormats returns the configured video formats or the default
+// video extensions.
+func (cfg *Config) acceptedVideoFormats() []string {
+	if formats := cfg.videoFormats(); len(formats) > 0 {
+		return formats
+	}
+	return videoExtensions
+}
+
+// isVideoName returns true if a stored file name has the extension of an
+// accepted video. Videos stored before the formats were restricted are
+// still recognised.
+func (cfg *Config) isVideoName(name string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	return containsPart(cfg.acceptedVideoFormats(), ext) || containsPart(videoExtensions, ext)
+}
+
+// videoFormats returns the lower case file extensions of configured video
+// containers or nil if all video extensions are accepted.
+func (cfg *Config) videoFormats() []string {
+	var formats []string
+	for _, format := range strings.Split(cfg.VideoFormats, ",") {
+		if format = strings.ToLower(strings.TrimSpace(format)); format != "" {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// videoPolicy describes the configured limits of video uploads for the
+// upload form. Empty fields are not limited.
+type videoPolicy struct {
+	Formats     string
+	MaxSize     uint64
+	MaxDuration string
+	MaxWidth    int
+	MaxHeight   int
+	Naming      bool
+}
+
+// videoPolicy returns the limits of video uploads. Duration and resolution
+// are only limited if videos are probed.
+func (cfg *Config) videoPolicy() videoPolicy {
+	policy := videoPolicy{Formats: strings.Join(cfg.videoFormats(), ", "), MaxSize: cfg.VideoMaxSize, Naming: cfg.VideoNaming}
+	if cfg.VideoProbeCommand == "" {
+		return policy
+	}
+	if cfg.VideoMaxDuration > 0 {
+		policy.MaxDuration = (time.Duration(cfg.VideoMaxDuration) * time.Second).String()
+	}
+	policy.MaxWidth, policy.MaxHeight = cfg.VideoMaxWidth, cfg.VideoMaxHeight
+	return policy
+}
+
+// videoBasename returns the file name without extension required by the
+// naming scheme AbstractNumber_FirstAuthor, or "" if the abstract number or
+// authors of the poster are unknown.
+func videoBasename(user *BCPoster) string {
+	number := strings.TrimSpace(user.AbstractNumber)
+	first := strings.FieldsFunc(strings.ReplaceAll(user.Authors, " and ", ","), func(r rune) bool { return r == ',' || r == ';' })
+	if number == "" || len(first) == 0 {
+		return ""
+	}
+	// affiliation numbers attached to the name are not part of it
+	name := strings.TrimRightFunc(surname(first[0]), unicode.IsDigit)
+	if name == "" {
+		return ""
+	}
+	return number + "_" + name
+}
+
+// followsNaming returns true if the file name matches the basename of the
+// naming scheme. Case is ignored and the author part may contain more names
+// before the surname, e.g. 42_vanDerBerg for 42_Berg.
+func followsNaming(name, basename string) bool {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	parts, expected := strings.SplitN(name, "_", 2), strings.SplitN(basename, "_", 2)
+	if len(parts) != 2 || !strings.EqualFold(strings.TrimSpace(parts[0]), expected[0]) {
+		return false
+	}
+	author := strings.Join(words(parts[1]), "")
+	return author != "" && strings.HasSuffix(author, strings.Join(words(expected[1]), ""))
+}
+
+// checkVideoUpload checks the file name and size of an uploaded video
+// against the configured video policy. It runs before the video is scanned
+// and probed.
+func checkVideoUpload(cfg *Config, user *BCPoster, upload *upload) *submissionError {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(upload.name), "."))
+	if formats := cfg.acceptedVideoFormats(); !containsPart(formats, ext) {
+		return newSubmissionError(http.StatusUnsupportedMediaType, "video_format_not_allowed", "error.videoformat",
+			upload.name, strings.Join(formats, ", "))
+	}
+	if cfg.VideoMaxSize > 0 && upload.size > int64(cfg.VideoMaxSize)*mib {
+		return newSubmissionError(http.StatusRequestEntityTooLarge, "video_too_large", "error.videotoolarge",
+			upload.name, fmt.Sprintf("%.1f", float64(upload.size)/mib), cfg.VideoMaxSize)
+	}
+	if basename := videoBasename(user); cfg.VideoNaming && basename != "" && !followsNaming(upload.name, basename) {
+		return newSubmissionError(http.StatusUnprocessableEntity, "video_name_invalid", "error.videoname",
+			upload.name, basename+filepath.Ext(upload.name))
+	}
+	return nil
+}
+
+// checkVideoInfo checks the probed container, duration and resolution of an
+// uploaded video against the configured video policy.
+func checkVideoInfo(cfg *Config, upload *upload, info *videoInfo) *submissionError {
+	if formats := cfg.videoFormats(); len(formats) > 0 {
+		accepted := false
+		for _, format := range formats {
+			if name, ok := containerNames[format]; ok {
+				format = name
+			}
+			accepted = accepted || strings.Contains(","+info.Container+",", ","+format+",")
+		}
+		if !accepted {
+			return newSubmissionError(http.StatusUnsupportedMediaType, "video_format_not_allowed", "error.videocontainer",
+				upload.name, info.Container, strings.Join(formats, ", "))
+		}
+	}
+	if max := time.Duration(cfg.VideoMaxDuration) * time.Second; max > 0 && info.Duration > max {
+		return newSubmissionError(http.StatusUnprocessableEntity, "video_too_long", "error.videotoolong",
+			info.Duration.Round(time.Second).String(), max.String())
+	}
+	if cfg.VideoMaxWidth > 0 && info.Width > cfg.VideoMaxWidth {
+		return newSubmissionError(http.StatusUnprocessableEntity, "video_resolution_too_high", "error.videowidth",
+			upload.name, info.Width, cfg.VideoMaxWidth)
+	}
+	if cfg.VideoMaxHeight > 0 && info.Height > cfg.VideoMaxHeight {
+		return newSubmissionError(http.StatusUnprocessableEntity, "video_resolution_too_high", "error.videoheight",
+			upload.name, info.Height, cfg.VideoMaxHeight)
+	}
+	return nil
+}
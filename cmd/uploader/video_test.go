@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubProber reads test videos, which are text files of the form
+// "video <container> <video codec> <audio codec> <seconds> [<width> <height>]".
+type stubProber struct{}
+
+func (stubProber) Probe(path string) (*videoInfo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if (len(fields) != 5 && len(fields) != 7) || fields[0] != "video" {
+		return nil, fmt.Errorf("no video stream found")
+	}
+	seconds, _ := strconv.Atoi(fields[4])
+	info := &videoInfo{Container: fields[1], VideoCodec: fields[2], AudioCodec: fields[3], Duration: time.Duration(seconds) * time.Second}
+	if len(fields) == 7 {
+		info.Width, _ = strconv.Atoi(fields[5])
+		info.Height, _ = strconv.Atoi(fields[6])
+	}
+	return info, nil
+}
+
+// stubTranscoder converts test videos to H.264 in MP4 or fails with err.
+type stubTranscoder struct {
+	err error
+}
+
+func (st stubTranscoder) Transcode(input, output string) error {
+	if st.err != nil {
+		return st.err
+	}
+	data, err := ioutil.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	return ioutil.WriteFile(output, []byte("video mp4 h264 aac "+fields[len(fields)-1]), 0644)
+}
+
+func TestParseProbe(t *testing.T) {
+	out := `{
+		"streams": [
+			{"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1920, "height": 1080},
+			{"index": 1, "codec_name": "aac", "codec_type": "audio"}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "312.480000"}
+	}`
+	info, err := parseProbe([]byte(out))
+	if err != nil {
+		t.Fatalf("Error parsing probe output: %v", err)
+	}
+	expected := videoInfo{Container: "mov,mp4,m4a,3gp,3g2,mj2", VideoCodec: "h264", AudioCodec: "aac", Width: 1920, Height: 1080, Duration: 312480 * time.Millisecond}
+	if *info != expected || !info.Standard() {
+		t.Fatalf("Unexpected video info %+v", info)
+	}
+
+	for _, info := range []videoInfo{
+		{Container: "matroska,webm", VideoCodec: "h264", AudioCodec: "aac"},
+		{Container: "mov,mp4,m4a,3gp,3g2,mj2", VideoCodec: "hevc", AudioCodec: "aac"},
+		{Container: "mov,mp4,m4a,3gp,3g2,mj2", VideoCodec: "h264", AudioCodec: "pcm_s16le"},
+	} {
+		if info.Standard() {
+			t.Errorf("Unexpected standard video %+v", info)
+		}
+	}
+
+	if _, err := parseProbe([]byte(`{"streams": [{"codec_type": "audio", "codec_name": "mp3"}], "format": {"duration": "1"}}`)); err == nil {
+		t.Fatal("Expected error for file without video stream")
+	}
+}
+
+func TestVideoProbe(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	uploader.prober = stubProber{}
+	cfg := uploader.Config()
+	cfg.Videos = true
+	cfg.VideoMaxDuration = 60
+
+	submit := func(name, content string) (int, []byte) {
+		files := map[string][2]string{"video": {name, content}}
+		req := newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+		req.Header.Set(uploadKeyHeader, "key")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		return w.Code, w.Body.Bytes()
+	}
+	for _, test := range []struct {
+		name, content, code string
+	}{
+		{"talk.mp4", "not a video", "invalid_video"},
+		{"talk.mp4", "video mp4 h264 aac 61", "video_too_long"},
+	} {
+		status, body := submit(test.name, test.content)
+		msg := apiError{}
+		if err := json.Unmarshal(body, &msg); err != nil || status != http.StatusUnprocessableEntity || msg.Code != test.code {
+			t.Errorf("Unexpected response for %q: %d %s", test.content, status, body)
+		}
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := submit("talk.mov", "video mov h264 aac 60")
+	result := submissionResult{}
+	if err := json.Unmarshal(body, &result); err != nil || status != http.StatusCreated {
+		t.Fatalf("Unexpected response %d: %s", status, body)
+	}
+	if result.VideoInfo == nil || result.VideoInfo.Duration != time.Minute || result.Video.Name != "id.mov" {
+		t.Fatalf("Unexpected submission result %+v", result)
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	uploader.prober = stubProber{}
+	cfg := uploader.Config()
+	cfg.Videos = true
+	tq, err := newTranscodeQueue(uploader.Config, uploader.templates.readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tq.transcoder = stubTranscoder{}
+	uploader.transcoder = tq
+	published := ""
+	tq.done = func(id string) { published = id }
+
+	submit := func(name, content string) {
+		files := map[string][2]string{"video": {name, content}}
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected status code %d: %s", w.Code, w.Body.String())
+		}
+	}
+	statusPage := func() string {
+		form := url.Values{"passcode": {"key"}}
+		req := httptest.NewRequest("POST", "/status", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	submit("talk.mov", "video mov hevc pcm_s16le 30")
+	if job := tq.Status("id"); job == nil || job.State != transcodeQueued || job.Source != "id.mov" {
+		t.Fatalf("Unexpected transcode job %+v", job)
+	}
+	if !strings.Contains(statusPage(), "waiting to be converted") {
+		t.Fatal("Queued job missing on status page")
+	}
+	// pending jobs are loaded again after a restart
+	if reloaded, err := newTranscodeQueue(uploader.Config, uploader.templates.readme); err != nil || reloaded.Status("id") == nil {
+		t.Fatalf("Transcode queue not saved: %v", err)
+	}
+
+	if !tq.Process() || tq.Process() {
+		t.Fatal("Expected exactly one job")
+	}
+	if job := tq.Status("id"); job.State != transcodeDone || published != "id" {
+		t.Fatalf("Unexpected transcode job %+v", job)
+	}
+	store := newStorage(cfg)
+	if data, err := readStored(store, "id.mp4"); err != nil || data != "video mp4 h264 aac 30" {
+		t.Fatalf("Unexpected transcoded video %q: %v", data, err)
+	}
+	if _, err := store.Stat("id.mov"); !os.IsNotExist(err) {
+		t.Fatalf("Uploaded video not replaced: %v", err)
+	}
+	if versions, err := listVersions(store, "id.mov"); err != nil || len(versions) != 1 {
+		t.Fatalf("Uploaded video not kept as older version %+v: %v", versions, err)
+	}
+	if current, _ := currentSubmission(cfg, &BCPoster{ID: "id"}); current.Video == nil || current.Video.Name != "id.mp4" {
+		t.Fatalf("Unexpected current video %+v", current.Video)
+	}
+	if !strings.Contains(statusPage(), "converted to MP4") {
+		t.Fatal("Finished job missing on status page")
+	}
+	entries := readManifest(t, cfg)
+	if len(entries) != 1 || entries[0].Action != actionTranscode || entries[0].Actor != actorSystem {
+		t.Fatalf("Unexpected manifest entries %+v", entries)
+	}
+
+	// standard videos are not transcoded
+	submit("talk.mp4", "video mp4 h264 aac 40")
+	if job := tq.Status("id"); job != nil {
+		t.Fatalf("Unexpected transcode job %+v", job)
+	}
+
+	// failures are shown to the presenter
+	tq.transcoder = stubTranscoder{err: fmt.Errorf("broken")}
+	submit("talk.avi", "video avi mpeg4 mp3 20")
+	tq.Process()
+	if job := tq.Status("id"); job == nil || job.State != transcodeFailed || job.Error != "broken" {
+		t.Fatalf("Unexpected transcode job %+v", job)
+	}
+	if !strings.Contains(statusPage(), "conversion to MP4 failed") {
+		t.Fatal("Failed job missing on status page")
+	}
+}
+
+// signalTranscoder transcodes like stubTranscoder and signals each
+// finished transcoding.
+type signalTranscoder struct {
+	stubTranscoder
+	done chan struct{}
+}
+
+func (st signalTranscoder) Transcode(input, output string) error {
+	defer func() { st.done <- struct{}{} }()
+	return st.stubTranscoder.Transcode(input, output)
+}
+
+func TestTranscodeReplacedVideo(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	transcoded := make(chan struct{}, 1)
+	uploader.prober = stubProber{}
+	cfg := uploader.Config()
+	cfg.Videos = true
+	tq, err := newTranscodeQueue(uploader.Config, uploader.templates.readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tq.transcoder = signalTranscoder{done: transcoded}
+	uploader.transcoder = tq
+	published := ""
+	tq.done = func(id string) { published = id }
+
+	files := map[string][2]string{"video": {"talk.mov", "video mov hevc pcm_s16le 30"}}
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, newSubmissionRequest(t, "/submit", map[string]string{"passcode": "key"}, files))
+	if w.Code != http.StatusOK || tq.Status("id") == nil {
+		t.Fatalf("Video not queued: %d %s", w.Code, w.Body.String())
+	}
+
+	// a submission holding the poster lock replaces the video after the
+	// transcoding finished, the result must not overwrite it
+	unlock := lockPoster("id")
+	processed := make(chan bool)
+	go func() { processed <- tq.Process() }()
+	<-transcoded
+	store := newStorage(cfg)
+	if err := store.Save("id.mov", strings.NewReader("video mov hevc pcm_s16le 60")); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if !<-processed {
+		t.Fatal("Expected a job")
+	}
+
+	if data, err := readStored(store, "id.mov"); err != nil || data != "video mov hevc pcm_s16le 60" {
+		t.Fatalf("Replaced video overwritten %q: %v", data, err)
+	}
+	if _, err := store.Stat("id.mp4"); !os.IsNotExist(err) || published != "" {
+		t.Fatalf("Transcoded video of the replaced upload stored: %v", err)
+	}
+	if len(posterLocks) != 0 {
+		t.Fatalf("Poster locks not released: %v", posterLocks)
+	}
+}
+
+func TestFollowsNaming(t *testing.T) {
+	user := &BCPoster{AbstractNumber: "W 42", Authors: "Anna van der Berg1, Bob Smith"}
+	basename := videoBasename(user)
+	if basename != "W 42_Berg" {
+		t.Fatalf("Unexpected basename %q", basename)
+	}
+	for name, expected := range map[string]bool{
+		"W 42_Berg.mp4":         true,
+		"w 42_berg.mov":         true,
+		"W 42_vanderBerg.mp4":   true,
+		"W 42_van der Berg.mp4": true,
+		"W 43_Berg.mp4":         false,
+		"W 42_Smith.mp4":        false,
+		"W 42.mp4":              false,
+		"Berg_W 42.mp4":         false,
+	} {
+		if followsNaming(name, basename) != expected {
+			t.Errorf("Unexpected naming check result for %q", name)
+		}
+	}
+	if basename := videoBasename(&BCPoster{Authors: "Bob Smith"}); basename != "" {
+		t.Errorf("Unexpected basename without abstract number %q", basename)
+	}
+}
+
+func TestVideoPolicy(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	uploader.prober = stubProber{}
+	cfg := uploader.Config()
+	cfg.Videos = true
+	cfg.VideoFormats = "mp4, MKV"
+	cfg.VideoMaxSize = 1
+	cfg.VideoMaxWidth, cfg.VideoMaxHeight = 1920, 1080
+	cfg.VideoNaming = true
+
+	for _, test := range []struct {
+		name, content string
+		status        int
+		code, message string
+	}{
+		{"W 42_Author.mov", "video mov h264 aac 10", http.StatusUnsupportedMediaType, "video_format_not_allowed", "mp4, mkv"},
+		{"W 42_Author.mp4", strings.Repeat("x", mib+1), http.StatusRequestEntityTooLarge, "video_too_large", "at most 1 MiB"},
+		{"Author_W42.mp4", "video mp4 h264 aac 10", http.StatusUnprocessableEntity, "video_name_invalid", "rename it to W 42_Author.mp4"},
+		{"W 42_Author.mkv", "video avi mpeg4 mp3 10", http.StatusUnsupportedMediaType, "video_format_not_allowed", "actually a avi file"},
+		{"W 42_Author.mp4", "video mp4 h264 aac 10 3840 1080", http.StatusUnprocessableEntity, "video_resolution_too_high", "3840 pixels wide"},
+		{"W 42_Author.mp4", "video mp4 h264 aac 10 1920 1200", http.StatusUnprocessableEntity, "video_resolution_too_high", "1200 pixels high"},
+		{"w 42_author.mkv", "video matroska,webm h264 aac 10 1920 1080", http.StatusCreated, "", ""},
+	} {
+		files := map[string][2]string{"video": {test.name, test.content}}
+		req := newSubmissionRequest(t, "/api/v1/submissions", nil, files)
+		req.Header.Set(uploadKeyHeader, "otherkey")
+		w := httptest.NewRecorder()
+		uploader.Web.Router.ServeHTTP(w, req)
+		msg := apiError{}
+		json.Unmarshal(w.Body.Bytes(), &msg)
+		if w.Code != test.status || msg.Code != test.code || !strings.Contains(msg.Message, test.message) {
+			t.Errorf("Unexpected response for %s: %d %s", test.name, w.Code, w.Body.String())
+		}
+	}
+
+	// the form lists the configured rules
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	for _, rule := range []string{"Accepted formats: mp4, mkv", "At most 1 MiB", "AbstractNumber_FirstAuthor</code>, e.g."} {
+		if !strings.Contains(w.Body.String(), rule) {
+			t.Errorf("Rule %q missing in form", rule)
+		}
+	}
+}
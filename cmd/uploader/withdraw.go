@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Manifest actors of presenters and of background jobs; admin actors are
+// returned by adminActor.
+const (
+	actorPresenter = "presenter"
+	actorSystem    = "system"
+)
+
+// adminActor returns the manifest actor of an admin request.
+func adminActor(r *http.Request) string {
+	user, _, _ := r.BasicAuth()
+	return "admin:" + user
+}
+
+// posterFiles returns the names of all stored files belonging to the
+// poster with the provided ID, including older versions, preview images and
+// metadata files.
+func posterFiles(store storage, id string) ([]string, error) {
+	files, err := store.List(id)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, name := range files {
+		if fileID, _, _, ok := parseStoredName(name); ok && fileID == id {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// clearVideoURL removes the current video URL of a poster. The URL is kept
+// as the newest older version.
+func (uploader *Uploader) clearVideoURL(cfg *Config, id, actor string) error {
+	defer lockPoster(id)()
+	store := newStorage(cfg)
+	name := id + ".url"
+	if _, err := store.Stat(name); err != nil {
+		return err
+	}
+	if err := rotateVersions(cfg, store, name); err != nil {
+		return err
+	}
+	// the file is not renamed if the same version is already kept
+	if err := store.Delete(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	log.Printf("Video URL of %q cleared by %s", id, actor)
+	if err := writeMetadata(cfg, uploader.templates.readme, id); err != nil {
+		log.Printf("Failed to write metadata of %q: %v", id, err)
+	}
+	return appendManifest(cfg, manifestEntry{ID: id, Action: actionClearVideoURL, Actor: actor})
+}
+
+// withdrawPoster moves all files of a poster including older versions to
+// a new directory in the withdrawn area and returns the moved files.
+func withdrawPoster(cfg *Config, id, actor string) ([]string, error) {
+	defer lockPoster(id)()
+	store := newStorage(cfg)
+	names, err := posterFiles(store, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	now := time.Now()
+	targetDir := filepath.Join(cfg.WithdrawnDirectory, fmt.Sprintf("%s-%s", id, now.Format("20060102T150405")))
+	if err := os.MkdirAll(targetDir, 0777); err != nil {
+		return nil, err
+	}
+	moved := make([]string, 0, len(names))
+	for _, name := range names {
+		target, err := moveToLocal(store, name, targetDir)
+		if err != nil {
+			log.Printf("Error moving file %s to %s: %v", name, targetDir, err)
+			continue
+		}
+		moved = append(moved, target)
+	}
+	log.Printf("Poster %q withdrawn by %s: %d files moved to %s", id, actor, len(moved), targetDir)
+	err = appendManifest(cfg, manifestEntry{Time: now, ID: id, Action: actionWithdraw, Actor: actor, Files: moved})
+	return moved, err
+}
+
+// presenterAction authenticates a presenter action on the status page and
+// renders the result page.
+func (uploader *Uploader) presenterAction(w http.ResponseWriter, r *http.Request, action func(*Config, *BCPoster) error, done string) {
+	cfg := uploader.Config()
+	data := cfg.templateData(w, r)
+	user, serr := uploader.authenticate(r.PostFormValue("passcode"))
+	if serr != nil {
+		uploader.templates.failure(w, serr.Status, data, serr.Message, serr.Args...)
+		return
+	}
+	if err := action(cfg, user); os.IsNotExist(err) {
+		uploader.templates.failure(w, http.StatusNotFound, data, "error.notfound")
+		return
+	} else if err != nil {
+		log.Printf("ERROR: %v", err)
+		uploader.templates.failure(w, http.StatusInternalServerError, data, "error.internal")
+		return
+	}
+	tmpl, err := uploader.templates.lookup(actionPage)
+	if err != nil {
+		log.Printf("Error rendering action page: %v", err)
+		uploader.templates.failure(w, http.StatusInternalServerError, data, "error.internal")
+		return
+	}
+	data["Message"] = tr(data["lang"].(string), done)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Error rendering action page: %v", err)
+	}
+}
+
+// statusClearVideoURL clears the video URL on request of the presenter.
+func (uploader *Uploader) statusClearVideoURL(w http.ResponseWriter, r *http.Request) {
+	uploader.presenterAction(w, r, func(cfg *Config, user *BCPoster) error {
+		if err := uploader.clearVideoURL(cfg, user.ID, actorPresenter); err != nil {
+			return err
+		}
+		uploader.publish(user.ID)
+		return nil
+	}, "action.videourlcleared")
+}
+
+// statusWithdraw withdraws the poster on request of the presenter. The
+// request must be confirmed with the "confirm" form field.
+func (uploader *Uploader) statusWithdraw(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("confirm") == "" {
+		data := uploader.Config().templateData(w, r)
+		uploader.templates.failure(w, http.StatusBadRequest, data, "error.confirmwithdraw")
+		return
+	}
+	uploader.presenterAction(w, r, func(cfg *Config, user *BCPoster) error {
+		if _, err := withdrawPoster(cfg, user.ID, actorPresenter); err != nil {
+			return err
+		}
+		uploader.publish(user.ID)
+		return nil
+	}, "action.withdrawn")
+}
+
+// adminClearVideoURL clears the video URL of a poster.
+func (uploader *Uploader) adminClearVideoURL(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	err := uploader.clearVideoURL(uploader.Config(), id, adminActor(r))
+	if os.IsNotExist(err) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no video URL stored"})
+		return
+	} else if err != nil {
+		log.Printf("ERROR clearing video URL of %q: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	uploader.publish(id)
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "action": actionClearVideoURL})
+}
+
+// adminWithdraw withdraws a poster.
+func (uploader *Uploader) adminWithdraw(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	moved, err := withdrawPoster(uploader.Config(), id, adminActor(r))
+	if os.IsNotExist(err) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no files stored"})
+		return
+	} else if err != nil {
+		log.Printf("ERROR withdrawing %q: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	uploader.publish(id)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "action": actionWithdraw, "files": moved})
+}
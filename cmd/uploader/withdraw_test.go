@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readManifest(t *testing.T, cfg *Config) []manifestEntry {
+	file, err := os.Open(cfg.ManifestFile)
+	if err != nil {
+		t.Fatalf("Error opening manifest: %v", err)
+	}
+	defer file.Close()
+	entries := make([]manifestEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := manifestEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid manifest entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func postStatusAction(uploader *Uploader, target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	return w
+}
+
+func TestClearVideoURL(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+
+	urlFile := filepath.Join(cfg.UploadDirectory, "id.url")
+	if err := ioutil.WriteFile(urlFile, []byte("https://example.com/video"), 0644); err != nil {
+		t.Fatalf("Error writing URL file: %v", err)
+	}
+
+	w := postStatusAction(uploader, "/status/clearvideourl", url.Values{"passcode": {"key"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	}
+	if _, err := os.Stat(urlFile); !os.IsNotExist(err) {
+		t.Fatal("Video URL file still exists")
+	}
+	versions, err := listVersions(newStorage(cfg), "id.url")
+	if err != nil || len(versions) != 1 || versions[0].Content != "https://example.com/video" {
+		t.Fatalf("Video URL not kept as older version %+v: %v", versions, err)
+	}
+
+	// nothing left to clear
+	w = postStatusAction(uploader, "/status/clearvideourl", url.Values{"passcode": {"key"}})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected not found status, got %d", w.Code)
+	}
+
+	entries := readManifest(t, cfg)
+	if len(entries) != 1 || entries[0].Action != actionClearVideoURL || entries[0].ID != "id" || entries[0].Actor != actorPresenter {
+		t.Fatalf("Unexpected manifest entries: %+v", entries)
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	uploader, cleanup := newTestUploader(t)
+	defer cleanup()
+	cfg := uploader.Config()
+	cfg.AdminPW = "adminsecret"
+
+	for _, name := range []string{"id.pdf", "id-v1.pdf", "id.url", "other.pdf", "id-other.pdf"} {
+		if err := writeTmpFile(filepath.Join(cfg.UploadDirectory, name)); err != nil {
+			t.Fatalf("Error creating test file: %v", err)
+		}
+	}
+
+	// withdrawal must be confirmed
+	w := postStatusAction(uploader, "/status/withdraw", url.Values{"passcode": {"key"}})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected bad request status, got %d", w.Code)
+	}
+	w = postStatusAction(uploader, "/status/withdraw", url.Values{"passcode": {"key"}, "confirm": {"yes"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	}
+	if err := checkDirFiles(cfg.UploadDirectory, 2); err != nil {
+		t.Fatalf("Unexpected files left in upload directory: %v", err)
+	}
+	entries := readManifest(t, cfg)
+	if len(entries) != 1 || entries[0].Action != actionWithdraw || len(entries[0].Files) != 3 {
+		t.Fatalf("Unexpected manifest entries: %+v", entries)
+	}
+	for _, fname := range entries[0].Files {
+		if _, err := os.Stat(fname); err != nil {
+			t.Fatalf("Withdrawn file missing: %v", err)
+		}
+	}
+
+	// admin withdrawal
+	req := httptest.NewRequest("POST", "/admin/posters/other/withdraw", nil)
+	req.SetBasicAuth("admin", "adminsecret")
+	w = httptest.NewRecorder()
+	uploader.Web.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	}
+	entries = readManifest(t, cfg)
+	if len(entries) != 2 || entries[1].ID != "other" || entries[1].Actor != "admin:admin" || len(entries[1].Files) != 1 {
+		t.Fatalf("Unexpected manifest entries: %+v", entries)
+	}
+}
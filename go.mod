@@ -4,5 +4,6 @@ go 1.15
 
 require (
 	github.com/G-Node/tonic v0.0.0-20200825120611-0d72dfe4428b
+	github.com/gorilla/mux v1.7.4
 	gopkg.in/yaml.v2 v2.2.2
 )